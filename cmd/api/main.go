@@ -1,16 +1,49 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/config"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/database"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/block"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/digest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/feed"
+	jobsHandlers "github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/notification"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/oauth"
+	realtimeHandlers "github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/realtime"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/seo"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/session"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/token"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/user"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/handlers/webhook"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/middleware"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	blockService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
 	blogService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	digestService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/digest"
+	feedService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/feed"
+	notificationService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/notification"
+	oauthService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/oauth"
+	seoService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/seo"
+	sessionService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
+	tokenService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/token"
 	userService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
+	webhookService "github.com/datmedevil17/BoldNarrativesBackend/internal/services/webhook"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,76 +61,321 @@ func main() {
 	if err := database.Migrate(); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
-	router := gin.Default()
+	if err := validation.Register(); err != nil {
+		log.Fatalf("Failed to register validators: %v", err)
+	}
+	router := gin.New()
+	// ClientIP feeds the sign-in and mail throttles, so only proxies we run
+	// may tell us who the client is
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(middleware.StreamTokenFromQuery(), gin.Logger(), gin.Recovery())
 	router.Use(middleware.CORSMiddleware())
 
+	mail, err := mailer.New(mailer.Config{
+		Driver:       cfg.MailDriver,
+		From:         cfg.MailFrom,
+		SMTPHost:     cfg.SMTPHost,
+		SMTPPort:     cfg.SMTPPort,
+		SMTPUsername: cfg.SMTPUsername,
+		SMTPPassword: cfg.SMTPPassword,
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	keys, err := utils.LoadKeySet(cfg.JWTSecret, cfg.JWTKeysDir, cfg.JWTActiveKeyID)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// background workers stop when the process is asked to shut down
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	db := database.GetDB()
-	userSvc := userService.NewService(db)
-	userHandler := user.NewHandler(userSvc, cfg.JWTSecret)
-	blogSvc := blogService.NewService(db)
-	blogHandler := blog.NewHandler(blogSvc, cfg.JWTSecret)
+	queue := jobs.NewQueue(db, cfg.JobWorkers)
+	broker := realtime.NewBroker(db, cfg.DatabaseURL)
+	go broker.Run(ctx)
+	notificationSvc := notificationService.NewService(db, broker, mail, cfg.AppURL)
+	webhookSvc := webhookService.NewService(db)
+	go webhookSvc.Run(ctx)
+	dispatcher := events.NewDispatcher(db)
+	userSvc := userService.NewService(db, mail, keys, dispatcher, queue, cfg.AppURL)
+	sessionSvc := sessionService.NewService(db, keys)
+	sessionHandler := session.NewHandler(sessionSvc)
+	userHandler := user.NewHandler(userSvc, sessionSvc)
+	blogSvc := blogService.NewService(db, broker, dispatcher)
+	blogHandler := blog.NewHandler(blogSvc, keys)
+	oauthSvc := oauthService.NewService(db, cfg.OIDCProviders, cfg.APIURL)
+	oauthHandler := oauth.NewHandler(oauthSvc, userSvc, sessionSvc, cfg.AppURL, strings.HasPrefix(cfg.APIURL, "https://"))
+
+	// every subscriber is registered before the dispatcher starts
+	notificationSvc.Subscribe(dispatcher)
+	webhookSvc.Subscribe(dispatcher)
+	blogSvc.Subscribe(dispatcher)
+	go dispatcher.Run(ctx)
+
+	digestSvc := digestService.NewService(db, mail, keys, notificationSvc, cfg.AppURL, cfg.APIURL)
 
-	SetUpRoutes(router, userHandler, blogHandler, cfg.JWTSecret)
-	addr:=fmt.Sprintf("%s",cfg.Port)
-	if err := router.Run(addr); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	// every job handler is registered before the workers start
+	userSvc.RegisterJobs(queue)
+	notificationSvc.RegisterJobs(queue)
+	digestSvc.RegisterJobs(queue)
+	if err := userSvc.QueueOrphanedExports(); err != nil {
+		log.Printf("Failed to queue orphaned data exports: %v", err)
 	}
+	queueDone := make(chan struct{})
+	go func() {
+		queue.Run(ctx)
+		close(queueDone)
+	}()
 
+	tokenSvc := tokenService.NewService(db)
+	tokenHandler := token.NewHandler(tokenSvc)
+	blockHandler := block.NewHandler(blockService.NewService(db, dispatcher))
+	notificationHandler := notification.NewHandler(notificationSvc)
+	// live streams outlast any shutdown timeout unless told to end
+	streamsCtx, stopStreams := context.WithCancel(context.Background())
+	defer stopStreams()
+	realtimeHandler := realtimeHandlers.NewHandler(streamsCtx, broker, blogSvc, userSvc)
+	digestHandler := digest.NewHandler(digestSvc)
+	webhookHandler := webhook.NewHandler(webhookSvc)
+	jobsHandler := jobsHandlers.NewHandler(queue)
+	seoHandler := seo.NewHandler(seoService.NewService(db, cfg.AppURL, cfg.APIURL))
+	feedHandler := feed.NewHandler(feedService.NewService(db, blogSvc, cfg.AppURL, cfg.APIURL, cfg.FeedContent == "full"))
+	auth := middleware.NewAuthenticator(keys, userSvc, tokenSvc, sessionSvc)
 
+	SetUpRoutes(router, Handlers{
+		User:         userHandler,
+		Blog:         blogHandler,
+		OAuth:        oauthHandler,
+		Token:        tokenHandler,
+		Session:      sessionHandler,
+		Block:        blockHandler,
+		Notification: notificationHandler,
+		Realtime:     realtimeHandler,
+		Digest:       digestHandler,
+		Webhook:      webhookHandler,
+		Jobs:         jobsHandler,
+		Feed:         feedHandler,
+		SEO:          seoHandler,
+	}, auth, keys, userSvc)
+
+	srv := &http.Server{Addr: cfg.Port, Handler: router}
+	srv.RegisterOnShutdown(stopStreams)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+	// let running jobs finish so they are not left for the stale reaper;
+	// none runs longer than JobTimeout
+	select {
+	case <-queueDone:
+	case <-time.After(jobs.JobTimeout):
+		log.Println("Timed out waiting for jobs to finish")
+	}
+}
+
+// Handlers groups every HTTP handler the router needs.
+type Handlers struct {
+	User         *user.Handler
+	Blog         *blog.Handler
+	OAuth        *oauth.Handler
+	Token        *token.Handler
+	Session      *session.Handler
+	Block        *block.Handler
+	Notification *notification.Handler
+	Realtime     *realtimeHandlers.Handler
+	Digest       *digest.Handler
+	Webhook      *webhook.Handler
+	Jobs         *jobsHandlers.Handler
+	Feed         *feed.Handler
+	SEO          *seo.Handler
 }
 
-func SetUpRoutes(router *gin.Engine, userHandler *user.Handler, blogHandler *blog.Handler, jwtSecret string) {
-	 api := router.Group("/api")
-    
-    // User routes
-    userRoutes := api.Group("/user")
-    {
-        // Public routes
-        userRoutes.POST("/signup", userHandler.SignUp)
-        userRoutes.POST("/signin", userHandler.SignIn)
-        userRoutes.GET("/getuser/:id", userHandler.GetUserById)
-        
-        // Protected routes
-        protected := userRoutes.Group("")
-        protected.Use(middleware.AuthMiddleware(jwtSecret))
-        {
-            protected.GET("/getid", userHandler.GetCurrentUserId)
-            protected.GET("/view/:id", userHandler.ViewProfile)
-            protected.GET("/profile", userHandler.GetProfile)
-            protected.POST("/follow/check", userHandler.CheckFollowStatus)
-            protected.POST("/follow", userHandler.FollowUser)
-            protected.POST("/unfollow", userHandler.UnFollowUser)
-            protected.GET("/followers", userHandler.GetFollowers)
-            protected.GET("/following", userHandler.GetFollowing)
-        }
-    }
-    
-    // Blog routes (all protected)
-    blogRoutes := api.Group("/blog")
-    blogRoutes.Use(middleware.AuthMiddleware(jwtSecret))
-    {
-        blogRoutes.POST("", blogHandler.CreateBlog)
-        blogRoutes.GET("/blog/:id", blogHandler.GetBlogById)
-        blogRoutes.PUT("/update/:id", blogHandler.UpdateBlog)
-        blogRoutes.DELETE("/delete/:id", blogHandler.DeleteBlog)
-        
-        blogRoutes.POST("total", blogHandler.GetTotalCount)
-        blogRoutes.POST("/sort/time/:id", blogHandler.SortByTime)
-        blogRoutes.POST("/sort/views", blogHandler.SortByViews)
-        blogRoutes.GET("/sort/trending", blogHandler.GetTrending)
-        
-        blogRoutes.PUT("/view", blogHandler.IncrementViews)
-        blogRoutes.POST("/vote/check", blogHandler.CheckVote)
-        blogRoutes.POST("/vote", blogHandler.ToggleVote)
-        
-        blogRoutes.POST("/comment", blogHandler.CreateComment)
-        blogRoutes.GET("/comment/:id", blogHandler.GetCommentsByBlogId)
-        blogRoutes.DELETE("/comment/:id", blogHandler.DeleteComment)
-    }
-    
-    // Health check
-    router.GET("/health", func(c *gin.Context) {
-        c.JSON(200, gin.H{"status": "ok"})
-    })
-	
+func SetUpRoutes(router *gin.Engine, h Handlers, auth *middleware.Authenticator, keys *utils.KeySet, userSvc *userService.Service) {
+	api := router.Group("/api")
+	requireVerified := middleware.RequireVerifiedEmail(userSvc)
+	requireSession := middleware.RequireSession()
+	scope := middleware.RequireScope
+
+	// User routes
+	userRoutes := api.Group("/user")
+	{
+		// Public routes
+		userRoutes.POST("/signup", h.User.SignUp)
+		userRoutes.POST("/signin", h.User.SignIn)
+		userRoutes.POST("/signin/2fa", h.User.SignInTwoFactor)
+		userRoutes.GET("/getuser/:id", h.User.GetUserById)
+		userRoutes.POST("/verify", h.User.VerifyEmail)
+		userRoutes.POST("/password/forgot", h.User.ForgotPassword)
+		userRoutes.POST("/password/reset", h.User.ResetPassword)
+
+		// Protected routes
+		protected := userRoutes.Group("")
+		protected.Use(middleware.AuthMiddleware(auth))
+		{
+			protected.GET("/getid", scope(models.ScopeReadProfile), h.User.GetCurrentUserId)
+			protected.GET("/view/:id", scope(models.ScopeReadProfile), h.User.ViewProfile)
+			protected.GET("/profile", scope(models.ScopeReadProfile), h.User.GetProfile)
+			protected.GET("/search", scope(models.ScopeReadProfile), h.User.SearchUsers)
+			protected.GET("/suggestions", scope(models.ScopeReadProfile), h.User.GetSuggestions)
+			protected.POST("/suggestions/:id/dismiss", scope(models.ScopeWriteFollows), h.User.DismissSuggestion)
+			protected.POST("/follow/check", scope(models.ScopeReadProfile), h.User.CheckFollowStatus)
+			protected.POST("/follow", scope(models.ScopeWriteFollows), h.User.FollowUser)
+			protected.POST("/unfollow", scope(models.ScopeWriteFollows), h.User.UnFollowUser)
+			protected.GET("/followers", scope(models.ScopeReadProfile), h.User.GetFollowers)
+			protected.GET("/following", scope(models.ScopeReadProfile), h.User.GetFollowing)
+			protected.GET("/followers/:id", scope(models.ScopeReadProfile), h.User.GetFollowers)
+			protected.GET("/followers/:id/mutual", scope(models.ScopeReadProfile), h.User.GetMutualFollowers)
+			protected.GET("/following/:id", scope(models.ScopeReadProfile), h.User.GetFollowing)
+			protected.GET("/follow/summary/:id", scope(models.ScopeReadProfile), h.User.GetFollowSummary)
+			protected.GET("/follow/requests", scope(models.ScopeReadProfile), h.User.ListFollowRequests)
+			protected.POST("/follow/requests/:id/approve", scope(models.ScopeWriteFollows), h.User.ApproveFollowRequest)
+			protected.POST("/follow/requests/:id/deny", scope(models.ScopeWriteFollows), h.User.DenyFollowRequest)
+
+			protected.GET("/blocks", scope(models.ScopeReadProfile), h.Block.ListBlocked)
+			protected.POST("/block/:id", scope(models.ScopeWriteFollows), h.Block.BlockUser)
+			protected.DELETE("/block/:id", scope(models.ScopeWriteFollows), h.Block.UnblockUser)
+			protected.GET("/mutes", scope(models.ScopeReadProfile), h.Block.ListMuted)
+			protected.POST("/mute/:id", scope(models.ScopeWriteFollows), h.Block.MuteUser)
+			protected.DELETE("/mute/:id", scope(models.ScopeWriteFollows), h.Block.UnmuteUser)
+		}
+
+		// Account management is off limits to access tokens
+		account := userRoutes.Group("")
+		account.Use(middleware.AuthMiddleware(auth), requireSession)
+		{
+			account.GET("/account", h.User.GetAccount)
+			account.POST("/verify/resend", h.User.ResendVerification)
+			account.POST("/password/change", h.User.ChangePassword)
+			account.POST("/2fa/enroll", h.User.EnrollTwoFactor)
+			account.POST("/2fa/confirm", h.User.ConfirmTwoFactor)
+			account.POST("/2fa/disable", h.User.DisableTwoFactor)
+			account.PUT("/privacy", h.User.SetPrivacy)
+			account.PUT("/handle", h.User.SetHandle)
+			account.PUT("/digest", h.Digest.SetFrequency)
+			account.POST("/tokens", h.Token.CreateToken)
+			account.GET("/tokens", h.Token.ListTokens)
+			account.DELETE("/tokens/:id", h.Token.RevokeToken)
+			account.GET("/sessions", h.Session.ListSessions)
+			account.DELETE("/sessions/:id", h.Session.RevokeSession)
+			account.DELETE("/sessions", h.Session.RevokeOtherSessions)
+			account.POST("/export", h.User.RequestExport)
+			account.GET("/export/:id", h.User.GetExport)
+			account.GET("/export/:id/download", h.User.DownloadExport)
+			account.POST("/account/delete", h.User.DeleteAccount)
+			account.POST("/account/delete/cancel", h.User.CancelAccountDeletion)
+		}
+	}
+
+	// Social login
+	authRoutes := api.Group("/auth")
+	{
+		authRoutes.GET("/providers", h.OAuth.ListProviders)
+		authRoutes.GET("/:provider/login", h.OAuth.Login)
+		authRoutes.GET("/:provider/callback", h.OAuth.Callback)
+	}
+
+	// Blog routes (all protected)
+	blogRoutes := api.Group("/blog")
+	blogRoutes.Use(middleware.AuthMiddleware(auth))
+	{
+		blogRoutes.POST("", scope(models.ScopeWriteBlogs), requireVerified, h.Blog.CreateBlog)
+		blogRoutes.GET("/blog/:id", scope(models.ScopeReadBlogs), h.Blog.GetBlogById)
+		blogRoutes.PUT("/update/:id", scope(models.ScopeWriteBlogs), requireVerified, h.Blog.UpdateBlog)
+		blogRoutes.DELETE("/delete/:id", scope(models.ScopeWriteBlogs), h.Blog.DeleteBlog)
+
+		blogRoutes.POST("total", scope(models.ScopeReadBlogs), h.Blog.GetTotalCount)
+		blogRoutes.POST("/sort/time/:id", scope(models.ScopeReadBlogs), h.Blog.SortByTime)
+		blogRoutes.POST("/sort/views", scope(models.ScopeReadBlogs), h.Blog.SortByViews)
+		blogRoutes.GET("/sort/trending", scope(models.ScopeReadBlogs), h.Blog.GetTrending)
+		blogRoutes.GET("/authors", scope(models.ScopeReadBlogs), h.Blog.GetAuthors)
+
+		blogRoutes.PUT("/view", scope(models.ScopeReadBlogs), h.Blog.IncrementViews)
+		blogRoutes.POST("/vote/check", scope(models.ScopeReadBlogs), h.Blog.CheckVote)
+		blogRoutes.POST("/vote", scope(models.ScopeWriteVotes), h.Blog.ToggleVote)
+
+		blogRoutes.POST("/comment", scope(models.ScopeWriteComments), requireVerified, h.Blog.CreateComment)
+		blogRoutes.GET("/comment/:id", scope(models.ScopeReadBlogs), h.Blog.GetCommentsByBlogId)
+		blogRoutes.DELETE("/comment/:id", scope(models.ScopeWriteComments), h.Blog.DeleteComment)
+
+		// WebSocket room with live comments, typing and readers
+		blogRoutes.GET("/live/:id", scope(models.ScopeReadBlogs), h.Realtime.Room)
+	}
+
+	notificationRoutes := api.Group("/notifications")
+	notificationRoutes.Use(middleware.AuthMiddleware(auth), scope(models.ScopeNotifications))
+	{
+		notificationRoutes.GET("", h.Notification.ListNotifications)
+		notificationRoutes.GET("/unread-count", h.Notification.UnreadCount)
+		notificationRoutes.POST("/:id/read", h.Notification.MarkRead)
+		notificationRoutes.POST("/read-all", h.Notification.MarkAllRead)
+		notificationRoutes.GET("/preferences", h.Notification.GetPreferences)
+		notificationRoutes.PUT("/preferences", requireSession, h.Notification.UpdatePreferences)
+	}
+
+	// Webhooks hold signing secrets, so they are managed like access tokens
+	webhookRoutes := api.Group("/webhooks")
+	webhookRoutes.Use(middleware.AuthMiddleware(auth), requireSession)
+	{
+		webhookRoutes.POST("", h.Webhook.CreateWebhook)
+		webhookRoutes.GET("", h.Webhook.ListWebhooks)
+		webhookRoutes.DELETE("/:id", h.Webhook.DeleteWebhook)
+		webhookRoutes.GET("/:id/deliveries", h.Webhook.ListDeliveries)
+		webhookRoutes.POST("/:id/deliveries/:deliveryId/redeliver", h.Webhook.Redeliver)
+	}
+
+	// Public syndication feeds, format is rss, atom or json
+	feedRoutes := api.Group("/feeds")
+	{
+		feedRoutes.GET("/latest/:format", h.Feed.Latest)
+		feedRoutes.GET("/genres/:genre/:format", h.Feed.Genre)
+		feedRoutes.GET("/tags/:tag/:format", h.Feed.Tag)
+		feedRoutes.GET("/authors/:id/:format", h.Feed.Author)
+	}
+
+	// Sitemaps and page metadata for search engines and the frontend
+	api.GET("/sitemap.xml", h.SEO.SitemapIndex)
+	api.GET("/sitemaps/:name", h.SEO.Sitemap)
+	api.GET("/seo/blog/:id", h.SEO.BlogMetadata)
+
+	// Background job administration
+	adminJobs := api.Group("/admin/jobs")
+	adminJobs.Use(middleware.AuthMiddleware(auth), requireSession, middleware.RequireAdmin(userSvc))
+	{
+		adminJobs.GET("", h.Jobs.ListJobs)
+		adminJobs.GET("/stats", h.Jobs.GetStats)
+		adminJobs.GET("/:id", h.Jobs.GetJob)
+		adminJobs.POST("/:id/retry", h.Jobs.RetryJob)
+	}
+
+	// One-click unsubscribe from email digests, authorized by the signed token
+	api.POST("/digest/unsubscribe", h.Digest.Unsubscribe)
+
+	// Live updates over Server-Sent Events
+	api.GET("/events", middleware.AuthMiddleware(auth), scope(models.ScopeReadBlogs), scope(models.ScopeNotifications), h.Realtime.Events)
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "ok"})
+	})
+
+	// Public keys for services that verify our tokens themselves
+	router.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(200, keys.JWKS())
+	})
+
 }
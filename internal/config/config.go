@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
@@ -11,7 +13,45 @@ import (
 type Config struct {
 	DatabaseURL string
 	JWTSecret   string
-	Port        string
+	// JWTKeysDir holds PEM keys for asymmetric signing; JWTActiveKeyID picks
+	// the one new tokens are signed with.
+	JWTKeysDir     string
+	JWTActiveKeyID string
+	Port           string
+	// AppURL is the public address of the frontend, used to build links
+	// in outgoing mail.
+	AppURL string
+	// APIURL is the public address of this server, used for OAuth redirect
+	// URIs.
+	APIURL string
+
+	// TrustedProxies are the addresses allowed to set X-Forwarded-For. Nil
+	// means clients connect directly and the header is ignored.
+	TrustedProxies []string
+
+	// FeedContent is "excerpt" or "full" and decides how much of each
+	// blog syndication feeds carry.
+	FeedContent string
+
+	// JobWorkers is how many background jobs this replica runs at once.
+	JobWorkers int
+
+	MailDriver   string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	OIDCProviders []OIDCProvider
+}
+
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
 }
 
 func getEnv(key, fallback string) string {
@@ -26,24 +66,98 @@ func LoadConfig() (*Config, error) {
 		log.Printf("Failed to load environment variables: %v", err)
 	}
 
+	jobWorkers, err := strconv.Atoi(getEnv("JOB_WORKERS", "4"))
+	if err != nil {
+		return nil, fmt.Errorf("JOB_WORKERS must be a number: %w", err)
+	}
+
 	port := getEnv("PORT", "8080")
 	if !strings.HasPrefix(port, ":") {
 		port = ":" + port
 	}
 
 	return &Config{
-		DatabaseURL: getEnv("DATABASE_URL", ""),
-		JWTSecret:   getEnv("JWT_SECRET", ""),
-		Port:        port,
+		DatabaseURL:    getEnv("DATABASE_URL", ""),
+		JWTSecret:      getEnv("JWT_SECRET", ""),
+		JWTKeysDir:     getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKeyID: getEnv("JWT_ACTIVE_KID", ""),
+		Port:           port,
+		AppURL:         strings.TrimSuffix(getEnv("APP_URL", "http://localhost:5173"), "/"),
+		APIURL:         strings.TrimSuffix(getEnv("API_URL", "http://localhost"+port), "/"),
+
+		TrustedProxies: splitList(getEnv("TRUSTED_PROXIES", "")),
+
+		FeedContent: getEnv("FEED_CONTENT", "excerpt"),
+		JobWorkers:  jobWorkers,
+
+		MailDriver:   getEnv("MAIL_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "BoldNarratives <no-reply@boldnarratives.local>"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		OIDCProviders: loadOIDCProviders(),
 	}, nil
 }
 
+// splitList reads a comma separated list, returning nil when it is empty.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS=google,acme and then
+// OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET and
+// optionally OIDC_GOOGLE_SCOPES for each name.
+func loadOIDCProviders() []OIDCProvider {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       []string{"openid", "email", "profile"},
+		}
+		if scopes := getEnv(prefix+"SCOPES", ""); scopes != "" {
+			provider.Scopes = strings.Fields(strings.ReplaceAll(scopes, ",", " "))
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 func (c *Config) Validate() error {
 	if c.DatabaseURL == "" {
 		log.Printf("DATABASE_URL is not set")
 	}
-	if c.JWTSecret == "" {
+	if c.JWTSecret == "" && c.JWTKeysDir == "" {
 		log.Printf("JWT_SECRET is not set")
 	}
+	if c.JWTKeysDir != "" && c.JWTActiveKeyID == "" {
+		log.Printf("JWT_KEYS_DIR is set but JWT_ACTIVE_KID is not, signing with JWT_SECRET")
+	}
+	if c.MailDriver == "smtp" && c.SMTPHost == "" {
+		log.Printf("MAIL_DRIVER is smtp but SMTP_HOST is not set")
+	}
+	if c.FeedContent != "excerpt" && c.FeedContent != "full" {
+		return fmt.Errorf("FEED_CONTENT must be excerpt or full, got %q", c.FeedContent)
+	}
+	for _, p := range c.OIDCProviders {
+		if p.Issuer == "" || p.ClientID == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer and a client id", p.Name)
+		}
+	}
 	return nil
 }
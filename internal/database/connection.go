@@ -17,7 +17,8 @@ func Connect(databaseURL string) error {
 	var counts int
 
 	for {
-		db, err = gorm.Open(postgres.Open(databaseURL), &gorm.Config{})
+		// translated errors let callers match gorm.ErrDuplicatedKey
+		db, err = gorm.Open(postgres.Open(databaseURL), &gorm.Config{TranslateError: true})
 		if err != nil {
 			log.Printf("Postgres not yet ready (%v)... retrying in 2 seconds", err)
 			counts++
@@ -7,10 +7,136 @@ import (
 )
 
 func Migrate() error {
-	err := DB.AutoMigrate(&models.User{}, &models.Blog{}, &models.Comment{}, &models.Vote{}, &models.Follows{})
+	// accounts created before email verification existed are trusted
+	grandfatherVerified := !DB.Migrator().HasColumn(&models.User{}, "email_verified")
+	// new accounts get a weekly digest, existing ones never asked for one
+	digestsOff := !DB.Migrator().HasColumn(&models.User{}, "digest_frequency")
+	// vote and comment counts are stored on blogs from here on
+	countBlogs := !DB.Migrator().HasColumn(&models.Blog{}, "vote_count")
+	// and indexed for full-text search
+	indexBlogs := !DB.Migrator().HasColumn(&models.Blog{}, "search_vector")
+
+	err := DB.AutoMigrate(
+		&models.User{},
+		&models.Blog{},
+		&models.BlogTag{},
+		&models.Comment{},
+		&models.Vote{},
+		&models.Follows{},
+		&models.PasswordResetToken{},
+		&models.AuditLog{},
+		&models.LoginThrottle{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OAuthState{},
+		&models.PersonalAccessToken{},
+		&models.Session{},
+		&models.DataExport{},
+		&models.Block{},
+		&models.Mute{},
+		&models.FollowRequest{},
+		&models.SuggestionDismissal{},
+		&models.Notification{},
+		&models.NotificationActor{},
+		&models.NotificationPreference{},
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+		&models.OutboxEvent{},
+		&models.OutboxHandled{},
+		&models.Job{},
+		&models.LiveReader{},
+	)
 	if err != nil {
 		log.Fatal("❌ Migration failed:", err)
 	}
+
+	if grandfatherVerified {
+		if err := DB.Exec("UPDATE users SET email_verified = true, email_verified_at = created_at").Error; err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
+	if digestsOff {
+		if err := DB.Exec("UPDATE users SET digest_frequency = 'off'").Error; err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
+	if countBlogs {
+		err := DB.Exec(`UPDATE blogs SET
+			vote_count = (SELECT COUNT(*) FROM votes WHERE votes.blog_id = blogs.id AND votes.deleted_at IS NULL),
+			comment_count = (SELECT COUNT(*) FROM comments WHERE comments.blog_id = blogs.id AND comments.deleted_at IS NULL)`).Error
+		if err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
+	if indexBlogs {
+		if err := DB.Exec("UPDATE blogs SET search_vector = " + models.BlogSearchDocument).Error; err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
+	// taken back votes used to be soft deleted and block voting again
+	if err := DB.Exec("DELETE FROM votes WHERE deleted_at IS NOT NULL").Error; err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+	if err := migrateGenres(); err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+	// the fuzzy user search runs on trigram indexes, the blog search on its
+	// vector index
+	for _, stmt := range []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_users_handle_trgm ON users USING gin (handle gin_trgm_ops)",
+		"CREATE INDEX IF NOT EXISTS idx_blogs_search ON blogs USING gin (search_vector)",
+	} {
+		if err := DB.Exec(stmt).Error; err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
+	// mail used to be queued fully rendered, reset and verification links included
+	if err := DB.Exec("DELETE FROM jobs WHERE kind = 'mail.send'").Error; err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+	// and reset jobs used to carry the email address they were asked for
+	if err := DB.Exec(`DELETE FROM jobs WHERE kind = 'user.password_reset' AND payload LIKE '%"email":%'`).Error; err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+	// lockout entries used to name the email address
+	if err := DB.Exec("UPDATE audit_logs SET detail = 'account' || substring(detail from ' locked for .*$') WHERE action = 'login.lockout' AND detail LIKE 'email:%'").Error; err != nil {
+		log.Fatal("❌ Migration failed:", err)
+	}
+	// workers look for due jobs, and a unique key only binds live jobs
+	for _, stmt := range []string{
+		"CREATE INDEX IF NOT EXISTS idx_jobs_due ON jobs (run_at) WHERE status = 'queued'",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_unique_key ON jobs (unique_key) WHERE status IN ('queued', 'running')",
+	} {
+		if err := DB.Exec(stmt).Error; err != nil {
+			log.Fatal("❌ Migration failed:", err)
+		}
+	}
 	log.Println("Migrations completed successfully")
 	return nil
 }
+
+// migrateGenres folds case variants of the known genres into their
+// canonical spelling and keeps any other genre already in use valid.
+func migrateGenres() error {
+	for _, genre := range models.Genres {
+		err := DB.Exec("UPDATE blogs SET genre = ? WHERE lower(genre) = lower(?) AND genre <> ?", genre, genre, genre).Error
+		if err != nil {
+			return err
+		}
+	}
+	var legacy []string
+	err := DB.Unscoped().Model(&models.Blog{}).
+		Where("genre NOT IN ?", models.Genres).
+		Distinct("genre").
+		Pluck("genre", &legacy).Error
+	if err != nil {
+		return err
+	}
+	if len(legacy) > 0 {
+		log.Printf("Keeping genres outside the known list: %v", legacy)
+		models.AddGenres(legacy...)
+	}
+	return nil
+}
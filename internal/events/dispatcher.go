@@ -0,0 +1,228 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	pollInterval = 2 * time.Second
+	batchSize    = 100
+	// a claimed event is retried after this long if its dispatcher died
+	claimLease = time.Minute
+
+	maxAttempts  = 10
+	firstBackoff = 5 * time.Second
+	maxBackoff   = time.Hour
+
+	// processed events are kept this long for debugging
+	retention = 7 * 24 * time.Hour
+)
+
+type eventIDKey struct{}
+
+// EventID returns the outbox id of the event being handled. It is stable
+// across retries, so handlers can use it to drop repeats.
+func EventID(ctx context.Context) uint {
+	id, _ := ctx.Value(eventIDKey{}).(uint)
+	return id
+}
+
+type subscriber struct {
+	name   string
+	types  map[string]bool
+	handle func(ctx context.Context, payload []byte) error
+}
+
+// Dispatcher delivers outbox events to in-process subscribers at least
+// once. A subscriber that fails is retried with backoff without rerunning
+// the ones that succeeded, but handlers must still be idempotent: a crash
+// between handling an event and recording it reruns the handler.
+type Dispatcher struct {
+	db          *gorm.DB
+	subscribers []subscriber
+	wake        chan struct{}
+}
+
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{db: db, wake: make(chan struct{}, 1)}
+}
+
+// On subscribes handle to events of type T under name, which identifies
+// the subscriber in the outbox and must stay stable across releases.
+// Subscribers must all be registered before Run.
+func On[T Event](d *Dispatcher, name string, handle func(ctx context.Context, e T) error) {
+	var zero T
+	eventType := zero.EventType()
+	for i := range d.subscribers {
+		if d.subscribers[i].name == name {
+			panic(fmt.Sprintf("events: subscriber %q registered twice", name))
+		}
+	}
+	d.subscribers = append(d.subscribers, subscriber{
+		name:  name,
+		types: map[string]bool{eventType: true},
+		handle: func(ctx context.Context, payload []byte) error {
+			var e T
+			if err := json.Unmarshal(payload, &e); err != nil {
+				return err
+			}
+			return handle(ctx, e)
+		},
+	})
+}
+
+// Wake makes Run dispatch now instead of at its next poll. Services call
+// it after committing events so reactions aren't delayed on this replica.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches outbox events until ctx is cancelled. Claiming rows with
+// SKIP LOCKED lets several replicas run it.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		d.dispatchDue(ctx)
+		if time.Since(lastCleanup) > time.Hour {
+			d.deleteProcessed()
+			lastCleanup = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		batch, err := d.claimDue()
+		if err != nil {
+			log.Printf("failed to claim outbox events: %v", err)
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+		handled, err := d.handledBy(batch)
+		if err != nil {
+			log.Printf("failed to load handled outbox events: %v", err)
+			return
+		}
+		for i := range batch {
+			d.dispatch(ctx, &batch[i], handled[batch[i].ID])
+		}
+	}
+}
+
+func (d *Dispatcher) claimDue() ([]models.OutboxEvent, error) {
+	now := time.Now()
+	var batch []models.OutboxEvent
+	err := d.db.Raw(`
+		UPDATE outbox_events SET available_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE processed_at IS NULL AND failed_at IS NULL AND available_at <= ?
+			ORDER BY id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(claimLease), now, batchSize).Scan(&batch).Error
+	return batch, err
+}
+
+// handledBy returns the subscribers that already handled each event.
+func (d *Dispatcher) handledBy(batch []models.OutboxEvent) (map[uint]map[string]bool, error) {
+	ids := make([]uint, 0, len(batch))
+	for _, e := range batch {
+		ids = append(ids, e.ID)
+	}
+	var rows []models.OutboxHandled
+	if err := d.db.Where("event_id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	handled := make(map[uint]map[string]bool, len(batch))
+	for _, r := range rows {
+		if handled[r.EventID] == nil {
+			handled[r.EventID] = map[string]bool{}
+		}
+		handled[r.EventID][r.Subscriber] = true
+	}
+	return handled, nil
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, event *models.OutboxEvent, handled map[string]bool) {
+	ctx = context.WithValue(ctx, eventIDKey{}, event.ID)
+	var errs []error
+	for _, sub := range d.subscribers {
+		if !sub.types[event.Type] || handled[sub.name] {
+			continue
+		}
+		if err := sub.handle(ctx, []byte(event.Payload)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+			continue
+		}
+		err := d.db.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.OutboxHandled{EventID: event.ID, Subscriber: sub.name}).Error
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_error": ""}
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("outbox event %d (%s) failed: %v", event.ID, event.Type, err)
+		updates["last_error"] = err.Error()
+		if event.Attempts >= maxAttempts {
+			updates["failed_at"] = now
+		} else {
+			updates["available_at"] = now.Add(backoff(event.Attempts))
+		}
+	} else {
+		updates["processed_at"] = now
+	}
+	if err := d.db.Model(&models.OutboxEvent{}).Where("id=?", event.ID).Updates(updates).Error; err != nil {
+		log.Printf("failed to record outbox event %d: %v", event.ID, err)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		if d := firstBackoff << (attempts - 1); d < maxBackoff {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (d *Dispatcher) deleteProcessed() {
+	cutoff := time.Now().Add(-retention)
+	err := d.db.Where("event_id IN (SELECT id FROM outbox_events WHERE processed_at < ?)", cutoff).
+		Delete(&models.OutboxHandled{}).Error
+	if err == nil {
+		err = d.db.Where("processed_at < ?", cutoff).Delete(&models.OutboxEvent{}).Error
+	}
+	if err != nil {
+		log.Printf("failed to delete processed outbox events: %v", err)
+	}
+}
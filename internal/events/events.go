@@ -0,0 +1,102 @@
+// Package events carries domain events from the services that cause them
+// to the features that react to them, through a transactional outbox.
+//
+// Notifications, webhooks and the live blog rooms subscribe, and so do the
+// vote and comment counts and the search index stored on blogs.
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Event is a domain event. Events carry ids rather than whole records;
+// subscribers load what they need, since the event may be handled long
+// after it was emitted.
+type Event interface {
+	EventType() string
+}
+
+type BlogPublished struct {
+	BlogID   uint `json:"blog_id"`
+	AuthorID uint `json:"author_id"`
+}
+
+type BlogUpdated struct {
+	BlogID   uint `json:"blog_id"`
+	AuthorID uint `json:"author_id"`
+}
+
+// BlogDeleted keeps the title because the blog is gone by the time it is
+// handled.
+type BlogDeleted struct {
+	BlogID   uint   `json:"blog_id"`
+	AuthorID uint   `json:"author_id"`
+	Title    string `json:"title"`
+}
+
+type CommentCreated struct {
+	CommentID uint  `json:"comment_id"`
+	BlogID    uint  `json:"blog_id"`
+	AuthorID  uint  `json:"author_id"`
+	ParentID  *uint `json:"parent_id,omitempty"`
+}
+
+type CommentDeleted struct {
+	CommentID uint `json:"comment_id"`
+	BlogID    uint `json:"blog_id"`
+}
+
+// VoteToggled is emitted when a vote is added (Voted) or taken back.
+type VoteToggled struct {
+	BlogID  uint `json:"blog_id"`
+	VoterID uint `json:"voter_id"`
+	Voted   bool `json:"voted"`
+}
+
+// UserFollowed is emitted for new follows, including approved follow
+// requests (Approved).
+type UserFollowed struct {
+	FollowerID  uint `json:"follower_id"`
+	FollowingID uint `json:"following_id"`
+	Approved    bool `json:"approved,omitempty"`
+}
+
+type FollowRequested struct {
+	RequesterID uint `json:"requester_id"`
+	TargetID    uint `json:"target_id"`
+}
+
+// AccessChanged is emitted when what UserIDs may see changes, through a
+// block, mute or unfollow, or when who may read AuthorID's posts does.
+type AccessChanged struct {
+	UserIDs  []uint `json:"user_ids,omitempty"`
+	AuthorID uint   `json:"author_id,omitempty"`
+}
+
+func (BlogPublished) EventType() string   { return "blog.published" }
+func (BlogUpdated) EventType() string     { return "blog.updated" }
+func (BlogDeleted) EventType() string     { return "blog.deleted" }
+func (CommentCreated) EventType() string  { return "comment.created" }
+func (CommentDeleted) EventType() string  { return "comment.deleted" }
+func (VoteToggled) EventType() string     { return "vote.toggled" }
+func (UserFollowed) EventType() string    { return "user.followed" }
+func (FollowRequested) EventType() string { return "follow.requested" }
+func (AccessChanged) EventType() string   { return "access.changed" }
+
+// Emit writes e to the outbox. tx should be the transaction that makes the
+// change e describes.
+func Emit(tx *gorm.DB, e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.OutboxEvent{
+		Type:        e.EventType(),
+		Payload:     string(payload),
+		AvailableAt: time.Now(),
+	}).Error
+}
@@ -0,0 +1,123 @@
+package block
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *block.Service
+}
+
+func NewHandler(service *block.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) BlockUser(c *gin.Context) {
+	targetId, ok := targetUserId(c)
+	if !ok {
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.Block(currentUserId, targetId); err != nil {
+		respondError(c, err, "Error blocking user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+func (h *Handler) UnblockUser(c *gin.Context) {
+	targetId, ok := targetUserId(c)
+	if !ok {
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.Unblock(currentUserId, targetId); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error unblocking user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
+
+func (h *Handler) ListBlocked(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	users, err := h.service.ListBlocked(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting blocked users")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func (h *Handler) MuteUser(c *gin.Context) {
+	targetId, ok := targetUserId(c)
+	if !ok {
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.Mute(currentUserId, targetId); err != nil {
+		respondError(c, err, "Error muting user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User muted"})
+}
+
+func (h *Handler) UnmuteUser(c *gin.Context) {
+	targetId, ok := targetUserId(c)
+	if !ok {
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.Unmute(currentUserId, targetId); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error unmuting user")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User unmuted"})
+}
+
+func (h *Handler) ListMuted(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	users, err := h.service.ListMuted(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting muted users")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func targetUserId(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid userId")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, block.ErrSelf):
+		utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, block.ErrUserMissing):
+		utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	default:
+		utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+	}
+}
@@ -1,6 +1,8 @@
 package blog
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -10,21 +12,21 @@ import (
 )
 
 type Handler struct {
-	service   *blog.Service
-	jwtSecret string
+	service *blog.Service
+	keys    *utils.KeySet
 }
 
-func NewHandler(service *blog.Service, jwtSecret string) *Handler {
+func NewHandler(service *blog.Service, keys *utils.KeySet) *Handler {
 	return &Handler{
-		service:   service,
-		jwtSecret: jwtSecret,
+		service: service,
+		keys:    keys,
 	}
 }
 
 func (h *Handler) CreateBlog(c *gin.Context) {
 	var req CreateBlogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	userId, ok := c.Get("userID")
@@ -33,7 +35,7 @@ func (h *Handler) CreateBlog(c *gin.Context) {
 		return
 	}
 	authorId := userId.(uint)
-	blog, err := h.service.CreateBlog(authorId, req.Title, req.Content, req.Genre)
+	blog, err := h.service.CreateBlog(authorId, req.Title, req.Content, req.Genre, req.Tags)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in blog creation")
 		return
@@ -47,7 +49,9 @@ func (h *Handler) GetBlogById(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid blog id")
 		return
 	}
-	blog, err := h.service.GetBlogById(uint(blogId))
+	userID, _ := c.Get("userID")
+	currentUserID := userID.(uint)
+	blog, err := h.service.GetBlogById(uint(blogId), currentUserID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusNotFound, "Blog not found")
 		return
@@ -65,12 +69,12 @@ func (h *Handler) UpdateBlog(c *gin.Context) {
 	}
 	var req UpdateBlogRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	userID, _ := c.Get("userID")
 	currentUserID := userID.(uint)
-	blog, err := h.service.UpdateBlog(uint(blogId), req.Title, req.Content, req.Genre, currentUserID)
+	blog, err := h.service.UpdateBlog(uint(blogId), req.Title, req.Content, req.Genre, req.Tags, currentUserID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in blog update")
 		return
@@ -102,37 +106,45 @@ func (h *Handler) DeleteBlog(c *gin.Context) {
 }
 func (h *Handler) GetTotalCount(c *gin.Context) {
 	var req FilterRequest
-	if err:=c.ShouldBindJSON(&req);err!=nil{
-		req=FilterRequest{}		
+	if err := c.ShouldBindJSON(&req); err != nil {
+		// an empty body counts every blog
+		if !errors.Is(err, io.EOF) {
+			utils.ValidationErrorResponse(c, err)
+			return
+		}
+		req = FilterRequest{}
 	}
-	opts:=blog.Filter{
+	userID, _ := c.Get("userID")
+	opts := blog.Filter{
+		ViewerID: userID.(uint),
 		Genre:    req.Genre,
+		Tag:      req.Tag,
 		AuthorID: req.AuthorID,
 		Search:   req.Search,
 	}
 
-	total,err:=h.service.GetBlogsCount(opts)
-	if err!=nil{
+	total, err := h.service.GetBlogsCount(opts)
+	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in getting blogs count")
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"total": total,
 	})
-	
-	
 
 }
 func (h *Handler) SortByTime(c *gin.Context) {
 	sortOrder := c.Query("sortOrder")
 	var req FilterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.String(http.StatusBadRequest, "Invalid request body")
-	
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
+	userID, _ := c.Get("userID")
 	opts := blog.Filter{
+		ViewerID: userID.(uint),
 		Genre:    req.Genre,
+		Tag:      req.Tag,
 		AuthorID: req.AuthorID,
 		Search:   req.Search,
 		Skip:     req.Skip,
@@ -151,11 +163,14 @@ func (h *Handler) SortByTime(c *gin.Context) {
 func (h *Handler) SortByViews(c *gin.Context) {
 	var req FilterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.String(http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
+	userID, _ := c.Get("userID")
 	opts := blog.Filter{
+		ViewerID: userID.(uint),
 		Genre:    req.Genre,
+		Tag:      req.Tag,
 		AuthorID: req.AuthorID,
 		Search:   req.Search,
 		Skip:     req.Skip,
@@ -171,7 +186,9 @@ func (h *Handler) SortByViews(c *gin.Context) {
 
 }
 func (h *Handler) GetTrending(c *gin.Context) {
-	blogs, err := h.service.GetTrendingBlogs()
+	userID, _ := c.Get("userID")
+	currentUserID := userID.(uint)
+	blogs, err := h.service.GetTrendingBlogs(currentUserID)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in getting trending blogs")
 		return
@@ -181,10 +198,32 @@ func (h *Handler) GetTrending(c *gin.Context) {
 	})
 
 }
+func (h *Handler) GetAuthors(c *gin.Context) {
+	var req AuthorsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	userID, _ := c.Get("userID")
+	authors, err := h.service.GetAuthors(blog.AuthorFilter{
+		ViewerID: userID.(uint),
+		Genre:    req.Genre,
+		Sort:     req.Sort,
+		Skip:     req.Skip,
+		Limit:    20,
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in getting authors")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"authors": authors,
+	})
+}
 func (h *Handler) IncrementViews(c *gin.Context) {
 	var req ViewRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	err := h.service.IncrementViews(req.ID)
@@ -200,7 +239,7 @@ func (h *Handler) IncrementViews(c *gin.Context) {
 func (h *Handler) CheckVote(c *gin.Context) {
 	var req VoteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	userID, _ := c.Get("userID")
@@ -218,13 +257,17 @@ func (h *Handler) CheckVote(c *gin.Context) {
 func (h *Handler) ToggleVote(c *gin.Context) {
 	var req VoteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	userID, _ := c.Get("userID")
 	currentUserID := userID.(uint)
 	vote, err := h.service.ToggleVote(req.ID, currentUserID)
 	if err != nil {
+		if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) {
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in toggling vote")
 		return
 	}
@@ -240,8 +283,14 @@ func (h *Handler) GetCommentsByBlogId(c *gin.Context) {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid blog id")
 		return
 	}
-	comments, err := h.service.GetCommentsByBlogId(uint(blogId))
+	userID, _ := c.Get("userID")
+	currentUserID := userID.(uint)
+	comments, err := h.service.GetCommentsByBlogId(uint(blogId), currentUserID)
 	if err != nil {
+		if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) {
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in getting comments")
 		return
 	}
@@ -252,13 +301,21 @@ func (h *Handler) GetCommentsByBlogId(c *gin.Context) {
 func (h *Handler) CreateComment(c *gin.Context) {
 	var req CreateCommentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+		utils.ValidationErrorResponse(c, err)
 		return
 	}
 	userID, _ := c.Get("userID")
 	currentUserID := userID.(uint)
-	comment, err := h.service.CreateComment(req.BlogID, currentUserID, req.Comment)
+	comment, err := h.service.CreateComment(req.BlogID, currentUserID, req.Comment, req.ParentID)
 	if err != nil {
+		if errors.Is(err, blog.ErrInvalidParent) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) {
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error occured in creating comment")
 		return
 	}
@@ -1,33 +1,46 @@
 package blog
 
-type CreateBlogRequest struct{
-	Title string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
-	Genre string `json:"genre" binding:"required"`
+type CreateBlogRequest struct {
+	Title   string   `json:"title" binding:"required,notblank,min=3,max=200"`
+	Content string   `json:"content" binding:"required,notblank,max=100000"`
+	Genre   string   `json:"genre" binding:"required,genre"`
+	Tags    []string `json:"tags" binding:"omitempty,max=5,dive,tag"`
 }
 
-type UpdateBlogRequest struct{
-	Title string `json:"title" binding:"required"`
-	Content string `json:"content" binding:"required"`
-	Genre string `json:"genre" binding:"required"`
+// UpdateBlogRequest leaves the tags alone when they are left out; an empty
+// list removes them.
+type UpdateBlogRequest struct {
+	Title   string   `json:"title" binding:"required,notblank,min=3,max=200"`
+	Content string   `json:"content" binding:"required,notblank,max=100000"`
+	Genre   string   `json:"genre" binding:"required,genre"`
+	Tags    []string `json:"tags" binding:"omitempty,max=5,dive,tag"`
 }
 
-type CreateCommentRequest struct{
-	Comment string `json:"comment" binding:"required"`
-	BlogID uint `json:"blog_id" binding:"required"`
+type CreateCommentRequest struct {
+	Comment string `json:"comment" binding:"required,notblank,max=2000"`
+	BlogID  uint   `json:"blog_id" binding:"required"`
+	// ParentID makes the comment a reply
+	ParentID *uint `json:"parent_id" binding:"omitempty,min=1"`
 }
 
-type ViewRequest struct{
+type ViewRequest struct {
 	ID uint `json:"blog_id" binding:"required"`
 }
 
-type VoteRequest struct{
+type VoteRequest struct {
 	ID uint `json:"blog_id" binding:"required"`
 }
 
-type FilterRequest struct{
-	Genre string `json:"genre"`
-	AuthorID *uint `json:"author_id"`
-	Search string `json:"search"`
-	Skip int `json:"skip"`
-}
\ No newline at end of file
+type FilterRequest struct {
+	Genre    string `json:"genre" binding:"omitempty,genre|eq=All"`
+	Tag      string `json:"tag" binding:"omitempty,tag"`
+	AuthorID *uint  `json:"author_id" binding:"omitempty,min=1"`
+	Search   string `json:"search" binding:"max=100"`
+	Skip     int    `json:"skip" binding:"min=0"`
+}
+
+type AuthorsRequest struct {
+	Genre string `form:"genre" binding:"omitempty,genre|eq=All"`
+	Sort  string `form:"sort" binding:"omitempty,oneof=followers votes recent"`
+	Skip  int    `form:"skip" binding:"min=0"`
+}
@@ -0,0 +1,53 @@
+package digest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/digest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *digest.Service
+}
+
+func NewHandler(service *digest.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) SetFrequency(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req FrequencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if err := h.service.SetFrequency(currentUserId, req.Frequency); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error updating digest frequency")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"digest_frequency": req.Frequency})
+}
+
+// Unsubscribe serves the signed link in every digest. Mail clients POST to
+// it directly for one-click unsubscribe, so it needs no sign-in.
+func (h *Handler) Unsubscribe(c *gin.Context) {
+	var req UnsubscribeRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if err := h.service.Unsubscribe(req.Token); err != nil {
+		if errors.Is(err, digest.ErrInvalidUnsubscribeToken) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error unsubscribing")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "You will no longer receive digest emails"})
+}
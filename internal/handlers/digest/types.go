@@ -0,0 +1,9 @@
+package digest
+
+type FrequencyRequest struct {
+	Frequency string `json:"frequency" binding:"required,oneof=off daily weekly"`
+}
+
+type UnsubscribeRequest struct {
+	Token string `form:"token" binding:"required"`
+}
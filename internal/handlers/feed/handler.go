@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/feed"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler serves public syndication feeds.
+type Handler struct {
+	feedService *feed.Service
+}
+
+func NewHandler(feedService *feed.Service) *Handler {
+	return &Handler{feedService: feedService}
+}
+
+func (h *Handler) Latest(c *gin.Context) {
+	f, err := h.feedService.Latest()
+	h.serve(c, f, err)
+}
+
+func (h *Handler) Genre(c *gin.Context) {
+	f, err := h.feedService.ForGenre(c.Param("genre"))
+	h.serve(c, f, err)
+}
+
+func (h *Handler) Tag(c *gin.Context) {
+	f, err := h.feedService.ForTag(c.Param("tag"))
+	h.serve(c, f, err)
+}
+
+func (h *Handler) Author(c *gin.Context) {
+	authorId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid author id")
+		return
+	}
+	f, err := h.feedService.ForAuthor(uint(authorId))
+	h.serve(c, f, err)
+}
+
+// serve renders the feed in the requested format and answers conditional
+// requests with 304 so feed readers polling often stay cheap.
+func (h *Handler) serve(c *gin.Context, f *feed.Feed, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, feed.ErrAuthorNotFound), errors.Is(err, feed.ErrUnknownGenre), errors.Is(err, feed.ErrInvalidTag):
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, blog.ErrPrivate):
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error building feed")
+		}
+		return
+	}
+	format := c.Param("format")
+	body, err := f.Render(format)
+	if err != nil {
+		if errors.Is(err, feed.ErrUnknownFormat) {
+			utils.ErrorResponse(c, http.StatusNotFound, "Feeds are available as rss, atom or json")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error building feed")
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	c.Header("ETag", etag)
+	// no Last-Modified: the newest item's time doesn't change when a post
+	// is deleted or hidden, the hash of the body does
+	c.Header("Cache-Control", "public, max-age=300")
+	if notModified(c.Request, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, feed.ContentType(format), body)
+}
+
+// notModified reports whether the client's copy, named by If-None-Match,
+// is still current.
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
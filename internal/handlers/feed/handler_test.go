@@ -0,0 +1,111 @@
+package feed
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/feed"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotModified(t *testing.T) {
+	const etag = `"abc"`
+
+	tests := []struct {
+		name        string
+		noneMatch   string
+		modSince    string
+		notModified bool
+	}{
+		{name: "no validators"},
+		{name: "matching etag", noneMatch: etag, notModified: true},
+		{name: "weak matching etag", noneMatch: `W/"abc"`, notModified: true},
+		{name: "etag in a list", noneMatch: `"old", "abc"`, notModified: true},
+		{name: "wildcard", noneMatch: "*", notModified: true},
+		{name: "stale etag", noneMatch: `"old"`},
+		// feeds send no Last-Modified, so dates can't vouch for a copy
+		{name: "date only", modSince: "Sun, 01 Mar 2026 12:00:00 GMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/feeds/latest.rss", nil)
+			if tt.noneMatch != "" {
+				r.Header.Set("If-None-Match", tt.noneMatch)
+			}
+			if tt.modSince != "" {
+				r.Header.Set("If-Modified-Since", tt.modSince)
+			}
+			if got := notModified(r, etag); got != tt.notModified {
+				t.Errorf("notModified = %v, want %v", got, tt.notModified)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := &feed.Feed{
+		Title:   "BoldNarratives",
+		Link:    "https://boldnarratives.test",
+		Updated: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		Items: []feed.Item{{
+			ID:        1,
+			Title:     "First",
+			URL:       "https://boldnarratives.test/blog/1",
+			Published: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+			Updated:   time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		}},
+	}
+	serve := func(format, noneMatch string, err error) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/feeds/latest."+format, nil)
+		if noneMatch != "" {
+			c.Request.Header.Set("If-None-Match", noneMatch)
+		}
+		c.Params = gin.Params{{Key: "format", Value: format}}
+		(&Handler{}).serve(c, f, err)
+		// gin writes a bare status once the handlers return
+		c.Writer.WriteHeaderNow()
+		return w
+	}
+
+	first := serve("rss", "", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" || first.Body.Len() == 0 {
+		t.Fatalf("first request: %d, ETag %q", first.Code, etag)
+	}
+	if got := first.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("Last-Modified = %q, want none", got)
+	}
+
+	tests := []struct {
+		name      string
+		format    string
+		noneMatch string
+		err       error
+		want      int
+	}{
+		{name: "same etag", format: "rss", noneMatch: etag, want: http.StatusNotModified},
+		// each format renders different bytes, so has its own etag
+		{name: "etag of another format", format: "atom", noneMatch: etag, want: http.StatusOK},
+		{name: "unknown format", format: "txt", want: http.StatusNotFound},
+		{name: "unknown genre", format: "rss", err: feed.ErrUnknownGenre, want: http.StatusNotFound},
+		{name: "invalid tag", format: "rss", err: feed.ErrInvalidTag, want: http.StatusNotFound},
+		{name: "unexpected error", format: "rss", err: errors.New("db down"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.format, tt.noneMatch, tt.err)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 carried a body")
+			}
+		})
+	}
+}
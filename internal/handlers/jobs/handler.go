@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler lets admins inspect and retry background jobs.
+type Handler struct {
+	queue *jobs.Queue
+}
+
+func NewHandler(queue *jobs.Queue) *Handler {
+	return &Handler{queue: queue}
+}
+
+func (h *Handler) ListJobs(c *gin.Context) {
+	var req ListJobsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+	list, total, err := h.queue.ListJobs(jobs.Filter{
+		Status: req.Status,
+		Kind:   req.Kind,
+		Skip:   req.Skip,
+		Limit:  req.Limit,
+	})
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting jobs")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":  list,
+		"total": total,
+	})
+}
+
+func (h *Handler) GetStats(c *gin.Context) {
+	stats, err := h.queue.Stats()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting job stats")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": stats})
+}
+
+func (h *Handler) GetJob(c *gin.Context) {
+	jobId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid job id")
+		return
+	}
+	job, err := h.queue.GetJob(uint(jobId))
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting job")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+func (h *Handler) RetryJob(c *gin.Context) {
+	jobId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid job id")
+		return
+	}
+	job, err := h.queue.RetryJob(uint(jobId))
+	if err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, jobs.ErrJobNotRetryable), errors.Is(err, jobs.ErrJobDuplicate):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error retrying job")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
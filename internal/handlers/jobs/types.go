@@ -0,0 +1,8 @@
+package jobs
+
+type ListJobsRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=queued running succeeded dead"`
+	Kind   string `form:"kind" binding:"max=100"`
+	Skip   int    `form:"skip" binding:"min=0"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
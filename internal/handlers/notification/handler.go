@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/notification"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *notification.Service
+}
+
+func NewHandler(service *notification.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) ListNotifications(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req ListNotificationsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	notifications, total, err := h.service.ListNotifications(currentUserId, req.Unread, req.Skip, req.Limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting notifications")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"total":         total,
+	})
+}
+
+func (h *Handler) UnreadCount(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	count, err := h.service.UnreadCount(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting unread count")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+func (h *Handler) MarkRead(c *gin.Context) {
+	notificationId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid notification id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.MarkRead(currentUserId, uint(notificationId)); err != nil {
+		if errors.Is(err, notification.ErrNotificationNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error marking notification read")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked read"})
+}
+
+func (h *Handler) MarkAllRead(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	marked, err := h.service.MarkAllRead(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error marking notifications read")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+func (h *Handler) GetPreferences(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	prefs, err := h.service.GetPreferencesResponse(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting notification preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func (h *Handler) UpdatePreferences(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	prefs, err := h.service.UpdatePreferences(currentUserId, notification.PreferencesUpdate{
+		Follows:         req.Follows,
+		Votes:           req.Votes,
+		Comments:        req.Comments,
+		Replies:         req.Replies,
+		Mentions:        req.Mentions,
+		Posts:           req.Posts,
+		Digests:         req.Digests,
+		QuietHoursStart: req.QuietHoursStart,
+		QuietHoursEnd:   req.QuietHoursEnd,
+		TimeZone:        req.TimeZone,
+	})
+	if err != nil {
+		if errors.Is(err, notification.ErrQuietHoursIncomplete) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error updating notification preferences")
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/notification"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBindPreferencesRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "nothing", body: `{}`},
+		{name: "quiet hours", body: `{"quiet_hours_start":"22:00","quiet_hours_end":"07:00","time_zone":"Europe/Berlin"}`},
+		{name: "clearing quiet hours", body: `{"quiet_hours_start":"","quiet_hours_end":""}`},
+		{name: "resetting the time zone", body: `{"time_zone":""}`},
+		{name: "nulls", body: `{"quiet_hours_start":null,"time_zone":null}`},
+		{name: "bad time", body: `{"quiet_hours_start":"25:00","quiet_hours_end":"07:00"}`, wantErr: true},
+		{name: "seconds", body: `{"quiet_hours_start":"22:00:00","quiet_hours_end":"07:00"}`, wantErr: true},
+		{name: "bad time zone", body: `{"time_zone":"Mars/Olympus"}`, wantErr: true},
+		{name: "bad channel", body: `{"votes":"sms"}`, wantErr: true},
+		{name: "empty channel", body: `{"votes":""}`, wantErr: true},
+		{name: "bad digest", body: `{"digests":"hourly"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPut, "/api/notifications/preferences", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			var req PreferencesRequest
+			err := c.ShouldBindJSON(&req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ShouldBindJSON = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				return
+			}
+			// every failure gets a readable message
+			for _, fe := range validation.Errors(err) {
+				if strings.HasPrefix(fe.Message, "failed the") {
+					t.Errorf("%s: %s", fe.Field, fe.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdatePreferencesClearsQuietHours(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := dbtest.Open(t, &models.User{}, &models.NotificationPreference{})
+	u := &models.User{Email: "ann@example.com", Name: "Ann", Password: "x"}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(notification.NewService(db, nil, nil, "https://app.test"))
+
+	update := func(body string) (int, models.NotificationPreferencesResponse) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/notifications/preferences", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("userID", u.ID)
+		h.UpdatePreferences(c)
+		var prefs models.NotificationPreferencesResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &prefs); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w.Code, prefs
+	}
+
+	code, prefs := update(`{"quiet_hours_start":"22:00","quiet_hours_end":"07:00","time_zone":"Europe/Berlin"}`)
+	if code != http.StatusOK || prefs.QuietHoursStart != "22:00" || prefs.QuietHoursEnd != "07:00" || prefs.TimeZone != "Europe/Berlin" {
+		t.Fatalf("setting quiet hours: %d %+v", code, prefs)
+	}
+	// clearing only one end would leave a half-open window
+	if code, _ := update(`{"quiet_hours_end":""}`); code != http.StatusBadRequest {
+		t.Fatalf("clearing one end: %d, want 400", code)
+	}
+	code, prefs = update(`{"quiet_hours_start":"","quiet_hours_end":"","time_zone":""}`)
+	if code != http.StatusOK || prefs.QuietHoursStart != "" || prefs.QuietHoursEnd != "" || prefs.TimeZone != "UTC" {
+		t.Fatalf("clearing quiet hours: %d %+v", code, prefs)
+	}
+}
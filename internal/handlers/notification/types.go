@@ -0,0 +1,22 @@
+package notification
+
+type ListNotificationsRequest struct {
+	Unread bool `form:"unread"`
+	Skip   int  `form:"skip" binding:"min=0"`
+	Limit  int  `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// PreferencesRequest only changes the fields it sets. Empty quiet hours
+// turn them off and an empty time zone resets it to UTC.
+type PreferencesRequest struct {
+	Follows         *string `json:"follows" binding:"omitnil,oneof=in_app email all none"`
+	Votes           *string `json:"votes" binding:"omitnil,oneof=in_app email all none"`
+	Comments        *string `json:"comments" binding:"omitnil,oneof=in_app email all none"`
+	Replies         *string `json:"replies" binding:"omitnil,oneof=in_app email all none"`
+	Mentions        *string `json:"mentions" binding:"omitnil,oneof=in_app email all none"`
+	Posts           *string `json:"posts" binding:"omitnil,oneof=in_app email all none"`
+	Digests         *string `json:"digests" binding:"omitnil,oneof=off daily weekly"`
+	QuietHoursStart *string `json:"quiet_hours_start" binding:"omitnil,eq=|datetime=15:04"`
+	QuietHoursEnd   *string `json:"quiet_hours_end" binding:"omitnil,eq=|datetime=15:04"`
+	TimeZone        *string `json:"time_zone" binding:"omitnil,eq=|timezone"`
+}
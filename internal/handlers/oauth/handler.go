@@ -0,0 +1,109 @@
+package oauth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/oauth"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// stateCookie ties a login flow to the browser that started it.
+const stateCookie = "oauth_state"
+
+type Handler struct {
+	service     *oauth.Service
+	userService *user.Service
+	sessions    *session.Service
+	appURL      string
+	// secureCookies is set when the API is served over https
+	secureCookies bool
+}
+
+func NewHandler(service *oauth.Service, userService *user.Service, sessions *session.Service, appURL string, secureCookies bool) *Handler {
+	return &Handler{
+		service:       service,
+		userService:   userService,
+		sessions:      sessions,
+		appURL:        appURL,
+		secureCookies: secureCookies,
+	}
+}
+
+func (h *Handler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.service.Providers()})
+}
+
+func (h *Handler) Login(c *gin.Context) {
+	authURL, state, err := h.service.AuthCodeURL(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		if errors.Is(err, oauth.ErrUnknownProvider) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		log.Printf("failed to start %s login: %v", c.Param("provider"), err)
+		utils.ErrorResponse(c, http.StatusBadGateway, "Login provider is unavailable")
+		return
+	}
+	h.setStateCookie(c, state, int(oauth.StateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback sends the browser back to the frontend with the result in the
+// URL fragment, which never reaches server logs.
+func (h *Handler) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		h.setStateCookie(c, "", -1)
+		h.redirect(c, url.Values{"error": {providerErr}})
+		return
+	}
+
+	browserState, _ := c.Cookie(stateCookie)
+	// the state is single use either way
+	h.setStateCookie(c, "", -1)
+	account, err := h.service.Callback(c.Request.Context(), c.Param("provider"), c.Query("state"), browserState, c.Query("code"))
+	if err != nil {
+		log.Printf("%s login failed: %v", c.Param("provider"), err)
+		h.redirect(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+
+	if account.TOTPEnabled {
+		challenge, err := h.userService.CreateTwoFactorChallenge(account)
+		if err != nil {
+			h.redirect(c, url.Values{"error": {"login_failed"}})
+			return
+		}
+		h.redirect(c, url.Values{"challenge_token": {challenge}})
+		return
+	}
+	token, err := h.sessions.IssueToken(account, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		h.redirect(c, url.Values{"error": {"login_failed"}})
+		return
+	}
+	h.redirect(c, url.Values{"token": {token}})
+}
+
+// setStateCookie stores or, with a negative maxAge, clears the state. Lax
+// is needed because the provider redirects back with a cross-site GET.
+func (h *Handler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/api/auth",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (h *Handler) redirect(c *gin.Context, fragment url.Values) {
+	c.Redirect(http.StatusFound, h.appURL+"/oauth/callback#"+fragment.Encode())
+}
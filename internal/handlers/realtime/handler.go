@@ -0,0 +1,104 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// keeps proxies from closing idle streams
+const heartbeatInterval = 25 * time.Second
+
+type Handler struct {
+	// shutdown is cancelled when the server shuts down, which doesn't
+	// cancel the requests themselves
+	shutdown context.Context
+	broker   *realtime.Broker
+	blogs    *blog.Service
+	users    *user.Service
+}
+
+func NewHandler(shutdown context.Context, broker *realtime.Broker, blogs *blog.Service, users *user.Service) *Handler {
+	return &Handler{shutdown: shutdown, broker: broker, blogs: blogs, users: users}
+}
+
+// Events streams the user's notifications and, with ?blog_id=, the comments
+// and vote counts of the blog they are reading, as Server-Sent Events.
+func (h *Handler) Events(c *gin.Context) {
+	var req EventsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if req.BlogID != 0 {
+		if err := h.blogs.CanView(req.BlogID, currentUserId); err != nil {
+			if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) {
+				utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+				return
+			}
+			utils.ErrorResponse(c, http.StatusNotFound, "Blog not found")
+			return
+		}
+	}
+
+	sub, err := h.broker.Subscribe(currentUserId, req.BlogID)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error opening event stream")
+		return
+	}
+	defer func() { h.broker.Unsubscribe(sub) }()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.SSEvent("ready", gin.H{"blog_id": req.BlogID})
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-sub.C:
+			c.SSEvent(e.Type, e)
+			return true
+		case <-sub.Revoked:
+			if sub, err = h.resubscribe(currentUserId, req.BlogID); err != nil {
+				c.SSEvent("revoked", gin.H{"blog_id": req.BlogID})
+				return false
+			}
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("ping", gin.H{"time": time.Now().Unix()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		case <-h.shutdown.Done():
+			return false
+		}
+	})
+}
+
+// resubscribe replaces a revoked subscription once the user is found to
+// still be allowed to watch blogId. A block, unfollow or privacy change may
+// have cut them off since they subscribed.
+func (h *Handler) resubscribe(userId, blogId uint) (*realtime.Subscription, error) {
+	if blogId != 0 {
+		if err := h.blogs.CanView(blogId, userId); err != nil {
+			return nil, err
+		}
+	}
+	return h.broker.Subscribe(userId, blogId)
+}
@@ -0,0 +1,269 @@
+package realtime
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/middleware"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	maxMessageSize = 8 * 1024
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingInterval   = pongWait * 9 / 10
+	// typing indicators from one connection are relayed at most this often
+	typingInterval = 3 * time.Second
+)
+
+// Messages clients send over a room socket.
+const (
+	messageComment = "comment"
+	messageTyping  = "typing"
+)
+
+// Replies sent only to the client that caused them.
+const (
+	replyCommentAccepted = "comment.accepted"
+	replyError           = "error"
+	// sent before closing the socket of a reader who lost access
+	replyRevoked = "revoked"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the API is open to every origin (see CORSMiddleware) and sockets are
+	// authenticated by bearer token rather than cookies, so a foreign page
+	// can't ride on a reader's session
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type roomClient struct {
+	conn       *websocket.Conn
+	userId     uint
+	name       string
+	blogId     uint
+	principal  *middleware.Principal
+	replies    chan realtime.Event
+	lastTyping time.Time
+}
+
+// Room upgrades to a WebSocket for one blog. The socket carries new and
+// deleted comments, vote counts, typing indicators and the live reader
+// count, and accepts comments that go through the same checks as
+// POST /api/blog/comment.
+func (h *Handler) Room(c *gin.Context) {
+	blogId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid blog id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.blogs.CanView(uint(blogId), currentUserId); err != nil {
+		if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) {
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusNotFound, "Blog not found")
+		return
+	}
+	account, err := h.users.GetUserById(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error opening live room")
+		return
+	}
+	principal, _ := c.Get("principal")
+
+	sub, err := h.broker.Subscribe(currentUserId, uint(blogId))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error opening live room")
+		return
+	}
+	defer h.broker.Unsubscribe(sub)
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader has already written the response
+		return
+	}
+	defer conn.Close()
+
+	connectionId, err := h.broker.Join(uint(blogId), currentUserId)
+	if err != nil {
+		log.Printf("failed to join live room for blog %d: %v", blogId, err)
+		return
+	}
+	defer h.broker.Leave(connectionId, uint(blogId))
+
+	client := &roomClient{
+		conn:      conn,
+		userId:    currentUserId,
+		name:      account.Name,
+		blogId:    uint(blogId),
+		principal: principal.(*middleware.Principal),
+		replies:   make(chan realtime.Event, 8),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.readRoom(client)
+	}()
+	h.writeRoom(client, sub, connectionId, done)
+}
+
+// writeRoom owns every write to the socket, as gorilla/websocket requires.
+func (h *Handler) writeRoom(client *roomClient, sub *realtime.Subscription, connectionId string, done <-chan struct{}) {
+	// Room only unsubscribes the first subscription
+	defer func() { h.broker.Unsubscribe(sub) }()
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	presence := time.NewTicker(realtime.PresenceInterval)
+	defer presence.Stop()
+
+	if readers, err := h.broker.Readers(client.blogId); err == nil {
+		client.send(realtime.Event{Type: realtime.EventReaders, BlogID: client.blogId}, gin.H{"readers": readers})
+	}
+	for {
+		var err error
+		select {
+		case e := <-sub.C:
+			if e.Type == realtime.EventTyping && e.ActorID == client.userId {
+				continue
+			}
+			err = client.write(e)
+		case <-sub.Revoked:
+			if sub, err = h.resubscribe(client.userId, client.blogId); err != nil {
+				client.write(realtime.Event{Type: replyRevoked, BlogID: client.blogId})
+				return
+			}
+		case e := <-client.replies:
+			err = client.write(e)
+		case <-presence.C:
+			if err := h.broker.Touch(connectionId); err != nil {
+				log.Printf("failed to refresh live reader: %v", err)
+			}
+		case <-ping.C:
+			client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err = client.conn.WriteMessage(websocket.PingMessage, nil)
+		case <-done:
+			return
+		case <-h.shutdown.Done():
+			client.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(writeWait))
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (h *Handler) readRoom(client *roomClient) {
+	client.conn.SetReadLimit(maxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg RoomMessage
+		if err := client.conn.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				client.reply(replyError, msg.Ref, gin.H{"error": "message is not valid JSON"})
+				continue
+			}
+			return
+		}
+		switch msg.Type {
+		case messageComment:
+			h.roomComment(client, &msg)
+		case messageTyping:
+			h.roomTyping(client)
+		default:
+			client.reply(replyError, msg.Ref, gin.H{"error": "unknown message type"})
+		}
+	}
+}
+
+func (h *Handler) roomComment(client *roomClient, msg *RoomMessage) {
+	if !client.principal.HasScope(models.ScopeWriteComments) {
+		client.reply(replyError, msg.Ref, gin.H{"error": "Access token is missing the " + models.ScopeWriteComments + " scope"})
+		return
+	}
+	verified, err := h.users.IsEmailVerified(client.userId)
+	if err != nil || !verified {
+		client.reply(replyError, msg.Ref, gin.H{"error": "Please verify your email address first"})
+		return
+	}
+	req := RoomCommentRequest{Comment: msg.Comment, ParentID: msg.ParentID}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		client.reply(replyError, msg.Ref, gin.H{"error": "Validation failed", "details": validation.Errors(err)})
+		return
+	}
+
+	comment, err := h.blogs.CreateComment(client.blogId, client.userId, req.Comment, req.ParentID)
+	if err != nil {
+		message := "Error occured in creating comment"
+		if errors.Is(err, blog.ErrBlocked) || errors.Is(err, blog.ErrPrivate) || errors.Is(err, blog.ErrInvalidParent) {
+			message = err.Error()
+		}
+		client.reply(replyError, msg.Ref, gin.H{"error": message})
+		return
+	}
+	client.reply(replyCommentAccepted, msg.Ref, gin.H{"comment_id": comment.ID})
+}
+
+func (h *Handler) roomTyping(client *roomClient) {
+	if time.Since(client.lastTyping) < typingInterval {
+		return
+	}
+	client.lastTyping = time.Now()
+	h.broker.Publish(realtime.Event{
+		Type:    realtime.EventTyping,
+		BlogID:  client.blogId,
+		ActorID: client.userId,
+	}, gin.H{"user_id": client.userId, "name": client.name})
+}
+
+// reply queues a message for this client only. Ref echoes the id the
+// client put on its message.
+func (client *roomClient) reply(replyType, ref string, data gin.H) {
+	if ref != "" {
+		data["ref"] = ref
+	}
+	client.send(realtime.Event{Type: replyType, BlogID: client.blogId}, data)
+}
+
+func (client *roomClient) send(e realtime.Event, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	e.Data = raw
+	select {
+	case client.replies <- e:
+	default:
+	}
+}
+
+func (client *roomClient) write(e realtime.Event) error {
+	client.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return client.conn.WriteJSON(e)
+}
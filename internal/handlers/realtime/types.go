@@ -0,0 +1,20 @@
+package realtime
+
+type EventsRequest struct {
+	BlogID uint `form:"blog_id"`
+}
+
+// RoomMessage is anything a client sends over a room socket. Ref is an
+// optional client-chosen id echoed back on the reply.
+type RoomMessage struct {
+	Type     string `json:"type"`
+	Ref      string `json:"ref"`
+	Comment  string `json:"comment"`
+	ParentID *uint  `json:"parent_id"`
+}
+
+// RoomCommentRequest has the same rules as blog.CreateCommentRequest.
+type RoomCommentRequest struct {
+	Comment  string `json:"comment" binding:"required,notblank,max=2000"`
+	ParentID *uint  `json:"parent_id" binding:"omitempty,min=1"`
+}
@@ -0,0 +1,79 @@
+package seo
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/seo"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const xmlContentType = "application/xml; charset=utf-8"
+
+// Handler serves sitemaps and page metadata for the server rendered
+// frontend and search engines.
+type Handler struct {
+	seoService *seo.Service
+}
+
+func NewHandler(seoService *seo.Service) *Handler {
+	return &Handler{seoService: seoService}
+}
+
+func (h *Handler) SitemapIndex(c *gin.Context) {
+	body, err := h.seoService.SitemapIndex()
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error building sitemap")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, xmlContentType, body)
+}
+
+// Sitemap serves one page of a section, named like blogs-1.xml.
+func (h *Handler) Sitemap(c *gin.Context) {
+	name, ok := strings.CutSuffix(c.Param("name"), ".xml")
+	i := strings.LastIndex(name, "-")
+	if !ok || i < 0 {
+		utils.ErrorResponse(c, http.StatusNotFound, seo.ErrSitemapNotFound.Error())
+		return
+	}
+	page, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, seo.ErrSitemapNotFound.Error())
+		return
+	}
+	body, err := h.seoService.Sitemap(name[:i], page)
+	if err != nil {
+		if errors.Is(err, seo.ErrSitemapNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error building sitemap")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, xmlContentType, body)
+}
+
+func (h *Handler) BlogMetadata(c *gin.Context) {
+	blogId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid blog id")
+		return
+	}
+	meta, err := h.seoService.BlogMetadata(uint(blogId))
+	if err != nil {
+		if errors.Is(err, seo.ErrBlogNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting blog metadata")
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"metadata": meta})
+}
@@ -0,0 +1,37 @@
+package seo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/seo"
+	"github.com/gin-gonic/gin"
+)
+
+// TestSitemapRejectsBadNames covers names that never reach the database.
+func TestSitemapRejectsBadNames(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewHandler(seo.NewService(nil, "https://app.test", "https://api.test"))
+
+	for _, name := range []string{
+		"blogs.xml",
+		"blogs-1",
+		"blogs-one.xml",
+		"blogs-0.xml",
+		"blogs--1.xml",
+		"users-1.xml",
+		"-1.xml",
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/sitemaps/"+name, nil)
+			c.Params = gin.Params{{Key: "name", Value: name}}
+			h.Sitemap(c)
+			if w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+		})
+	}
+}
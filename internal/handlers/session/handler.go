@@ -0,0 +1,58 @@
+package session
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *session.Service
+}
+
+func NewHandler(service *session.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) ListSessions(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	sessions, err := h.service.ListSessions(currentUserId, c.GetString("sessionID"))
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.RevokeSession(currentUserId, c.Param("id")); err != nil {
+		if errors.Is(err, session.ErrSessionNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error signing out session")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
+
+// RevokeOtherSessions signs out every device except the one making the
+// request.
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.RevokeOtherSessions(currentUserId, c.GetString("sessionID")); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error signing out sessions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Signed out of all other sessions"})
+}
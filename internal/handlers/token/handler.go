@@ -0,0 +1,79 @@
+package token
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/token"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *token.Service
+}
+
+func NewHandler(service *token.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) CreateToken(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	created, plain, err := h.service.CreateToken(currentUserId, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error creating access token")
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"token":        plain,
+		"access_token": created.ToResponse(),
+		"message":      "Copy this token now, it won't be shown again",
+	})
+}
+
+func (h *Handler) ListTokens(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	tokens, err := h.service.ListTokens(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting access tokens")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+func (h *Handler) RevokeToken(c *gin.Context) {
+	tokenId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid token id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.RevokeToken(currentUserId, uint(tokenId)); err != nil {
+		if errors.Is(err, token.ErrTokenNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error revoking access token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
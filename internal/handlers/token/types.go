@@ -0,0 +1,7 @@
+package token
+
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required,notblank,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,unique,dive,scope"`
+	ExpiresInDays *int     `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
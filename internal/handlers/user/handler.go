@@ -1,41 +1,53 @@
 package user
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
 
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-	service   *user.Service
-	jwtSecret string
+	service  *user.Service
+	sessions *session.Service
 }
 
-func NewHandler(service *user.Service, jwtSecret string) *Handler {
+func NewHandler(service *user.Service, sessions *session.Service) *Handler {
 	return &Handler{
-		service:   service,
-		jwtSecret: jwtSecret,
+		service:  service,
+		sessions: sessions,
 	}
 }
 
 func (h *Handler) SignUp(c *gin.Context) {
 	var req SignUpRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Enter valid email")
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
-	user, err := h.service.CreateUser(req.Email, req.Name, req.Password)
+	account, err := h.service.CreateUser(req.Email, req.Name, req.Password)
 	if err != nil {
 		if err.Error() == "user already exists" {
 			utils.ErrorResponse(c, http.StatusConflict, err.Error())
 			return
 		}
+		if errors.Is(err, user.ErrReservedEmail) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
 		return
 	}
-	token, err := utils.GenerateToken(user.Email, user.ID, h.jwtSecret)
+	token, err := h.sessions.IssueToken(account, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error generating token")
 		return
@@ -43,17 +55,233 @@ func (h *Handler) SignUp(c *gin.Context) {
 	c.String(http.StatusOK, token)
 }
 
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if _, err := h.service.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, user.ErrInvalidVerificationToken) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func (h *Handler) ResendVerification(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	err := h.service.ResendVerificationEmail(currentUserId, c.ClientIP())
+	if err != nil {
+		var locked *user.LockedError
+		switch {
+		case errors.As(err, &locked):
+			tooManyMailRequests(c, locked)
+		case errors.Is(err, user.ErrAlreadyVerified):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error sending verification email")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
 func (h *Handler) SignIn(c *gin.Context) {
 	var req SignInRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Enter valid email")
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
-	user, err := h.service.AuthenticateUser(req.Email, req.Password)
+	account, err := h.service.AuthenticateUser(req.Email, req.Password, c.ClientIP())
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, err.Error())
+		var locked *user.LockedError
+		switch {
+		case errors.As(err, &locked):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			utils.ErrorResponse(c, http.StatusTooManyRequests, locked.Error())
+		case errors.Is(err, user.ErrInvalidCredentials):
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
+	}
+	if account.TOTPEnabled {
+		challenge, err := h.service.CreateTwoFactorChallenge(account)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error generating token")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
 		return
 	}
-	token, err := utils.GenerateToken(user.Email, user.ID, h.jwtSecret)
+	token, err := h.sessions.IssueToken(account, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+func (h *Handler) SignInTwoFactor(c *gin.Context) {
+	var req TwoFactorSignInRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	account, err := h.service.CompleteTwoFactorChallenge(req.ChallengeToken, req.Code, c.ClientIP())
+	if err != nil {
+		var locked *user.LockedError
+		switch {
+		case errors.As(err, &locked):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			utils.ErrorResponse(c, http.StatusTooManyRequests, locked.Error())
+		case errors.Is(err, user.ErrInvalidChallenge), errors.Is(err, user.ErrInvalidTwoFactor):
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
+	}
+	token, err := h.sessions.IssueToken(account, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+func (h *Handler) EnrollTwoFactor(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	enrollment, err := h.service.EnrollTwoFactor(currentUserId)
+	if err != nil {
+		if errors.Is(err, user.ErrTwoFactorEnabled) {
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func (h *Handler) ConfirmTwoFactor(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	codes, err := h.service.ConfirmTwoFactor(currentUserId, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrTwoFactorEnabled):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		case errors.Is(err, user.ErrTwoFactorNotPending), errors.Is(err, user.ErrInvalidTwoFactor):
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe",
+		"recovery_codes": codes,
+	})
+}
+
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	err := h.service.DisableTwoFactor(currentUserId, req.Password, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrTwoFactorNotEnabled):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		case errors.Is(err, user.ErrIncorrectPassword), errors.Is(err, user.ErrInvalidTwoFactor):
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if err := h.service.RequestPasswordReset(req.Email, c.ClientIP()); err != nil {
+		var locked *user.LockedError
+		if errors.As(err, &locked) {
+			tooManyMailRequests(c, locked)
+			return
+		}
+		log.Printf("failed to queue password reset email: %v", err)
+	}
+	// same answer whether or not the account exists
+	c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if err := h.service.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, user.ErrInvalidResetToken) {
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully. Please sign in again"})
+}
+
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	updated, err := h.service.ChangePassword(currentUserId, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, user.ErrIncorrectPassword) {
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	// every other session was just signed out, so hand this one a fresh token
+	token, err := h.sessions.IssueToken(updated, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Error generating token")
 		return
@@ -78,6 +306,19 @@ func (h *Handler) GetUserById(c *gin.Context) {
 
 }
 
+// GetAccount returns the signed-in user's own account.
+func (h *Handler) GetAccount(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	account, err := h.service.GetUserById(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, account.ToAccountResponse())
+}
+
 func (h *Handler) GetCurrentUserId(c *gin.Context) {
 	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
@@ -128,15 +369,17 @@ func (h *Handler) CheckFollowStatus(c *gin.Context) {
 
 	var req FollowRequest
 	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Enter valid user id")
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
 	if currentUserId == req.TargetUserIdParam {
 		utils.ErrorResponse(c, http.StatusBadRequest, "You cannot follow yourself")
 		return
 	}
-	followStatus, err := h.service.CheckIfFollowing(req.TargetUserIdParam, currentUserId)
+	followStatus, err := h.service.CheckIfFollowing(currentUserId, req.TargetUserIdParam)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"followStatus": followStatus})
 
@@ -147,13 +390,28 @@ func (h *Handler) FollowUser(c *gin.Context) {
 
 	var req FollowRequest
 	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Enter valid user id")
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
-	err := h.service.FollowUser(req.TargetUserIdParam, currentUserId)
+	requested, err := h.service.FollowUser(currentUserId, req.TargetUserIdParam)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		switch {
+		case errors.Is(err, user.ErrFollowBlocked):
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		case errors.Is(err, user.ErrAlreadyRequested):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		case errors.Is(err, user.ErrUserNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
+	}
+	if requested {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Follow request sent", "requested": true})
+		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "Followed successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Followed successfully", "requested": false})
 
 }
 func (h *Handler) UnFollowUser(c *gin.Context) {
@@ -162,32 +420,365 @@ func (h *Handler) UnFollowUser(c *gin.Context) {
 
 	var req FollowRequest
 	if err := c.ShouldBindBodyWithJSON(&req); err != nil {
-		utils.ErrorResponse(c, http.StatusBadRequest, "Enter valid user id")
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
-	err := h.service.UnFollowUser(req.TargetUserIdParam, currentUserId)
+	err := h.service.UnFollowUser(currentUserId, req.TargetUserIdParam)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed successfully"})
 }
 
 func (h *Handler) GetFollowers(c *gin.Context) {
+	h.listFollows(c, "followers", h.service.GetFollowers)
+}
+
+func (h *Handler) GetFollowing(c *gin.Context) {
+	h.listFollows(c, "following", h.service.GetFollowing)
+}
+
+func (h *Handler) GetMutualFollowers(c *gin.Context) {
+	h.listFollows(c, "mutuals", h.service.GetMutualFollowers)
+}
+
+func (h *Handler) GetFollowSummary(c *gin.Context) {
+	targetId, ok := followTarget(c)
+	if !ok {
+		return
+	}
 	userId, _ := c.Get("userID")
 	currentUserId := userId.(uint)
-	followers, err := h.service.GetFollowers(currentUserId)
+
+	summary, err := h.service.GetFollowSummary(targetId, currentUserId)
 	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
 		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+type followLister func(userId, viewerId uint, page user.Page) ([]models.FollowResponse, int64, error)
+
+// listFollows serves a paginated follow list for the user in the :id
+// param, or for the current user when there is none.
+func (h *Handler) listFollows(c *gin.Context, key string, list followLister) {
+	targetId, ok := followTarget(c)
+	if !ok {
+		return
+	}
+	var req PageRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	follows, total, err := list(targetId, currentUserId, user.Page{Skip: req.Skip, Limit: req.Limit})
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrUserNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, user.ErrPrivateAccount):
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		}
+		return
 	}
-	c.JSON(http.StatusOK, followers)
+	c.JSON(http.StatusOK, gin.H{
+		key:     follows,
+		"total": total,
+		"skip":  req.Skip,
+		"limit": req.Limit,
+	})
+}
 
+func followTarget(c *gin.Context) (uint, bool) {
+	if c.Param("id") == "" {
+		userId, _ := c.Get("userID")
+		return userId.(uint), true
+	}
+	targetId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid userId")
+		return 0, false
+	}
+	return uint(targetId), true
 }
-func (h *Handler) GetFollowing(c *gin.Context) {
+
+func (h *Handler) SetPrivacy(c *gin.Context) {
 	userId, _ := c.Get("userID")
 	currentUserId := userId.(uint)
-	following, err := h.service.GetFollowing(currentUserId)
+
+	var req PrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if err := h.service.SetPrivate(currentUserId, *req.Private); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error updating privacy")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"is_private": *req.Private})
+}
+
+func (h *Handler) ListFollowRequests(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	requests, err := h.service.ListFollowRequests(currentUserId)
 	if err != nil {
-		utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting follow requests")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests})
+}
+
+func (h *Handler) ApproveFollowRequest(c *gin.Context) {
+	requestId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.ApproveFollowRequest(currentUserId, uint(requestId)); err != nil {
+		if errors.Is(err, user.ErrFollowRequestNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error approving follow request")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Follow request approved"})
+}
+
+func (h *Handler) DenyFollowRequest(c *gin.Context) {
+	requestId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.DenyFollowRequest(currentUserId, uint(requestId)); err != nil {
+		if errors.Is(err, user.ErrFollowRequestNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error denying follow request")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Follow request denied"})
+}
+
+func (h *Handler) SetHandle(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req HandleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	account, err := h.service.SetHandle(currentUserId, req.Handle)
+	if err != nil {
+		if errors.Is(err, user.ErrHandleTaken) {
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error updating handle")
+		return
+	}
+	c.JSON(http.StatusOK, account.ToAccountResponse())
+}
+
+func (h *Handler) SearchUsers(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req SearchUsersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	users, err := h.service.SearchUsers(currentUserId, req.Query, req.Skip, req.Limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error searching users")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+func (h *Handler) GetSuggestions(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req SuggestionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
 	}
-	c.JSON(http.StatusOK, following)
+	if req.Limit == 0 {
+		req.Limit = 10
+	}
+	suggestions, err := h.service.SuggestFollows(currentUserId, req.Limit)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting suggestions")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+func (h *Handler) DismissSuggestion(c *gin.Context) {
+	dismissedId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid userId")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.DismissSuggestion(currentUserId, uint(dismissedId)); err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error dismissing suggestion")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Suggestion dismissed"})
+}
+
+func (h *Handler) RequestExport(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req ExportRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	export, err := h.service.RequestExport(currentUserId, req.Format)
+	if err != nil {
+		if errors.Is(err, user.ErrExportPending) {
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error requesting export")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"export": export})
+}
+
+func (h *Handler) GetExport(c *gin.Context) {
+	exportId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid export id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	export, err := h.service.GetExport(currentUserId, uint(exportId))
+	if err != nil {
+		if errors.Is(err, user.ErrExportNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting export")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"export": export})
+}
+
+func (h *Handler) DownloadExport(c *gin.Context) {
+	exportId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid export id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	export, err := h.service.DownloadExport(currentUserId, uint(exportId))
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrExportNotFound):
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, user.ErrExportNotReady):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error downloading export")
+		}
+		return
+	}
+	contentType := "application/json"
+	if export.Format == "zip" {
+		contentType = "application/zip"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="boldnarratives-export-%d.%s"`, export.ID, export.Format))
+	c.Data(http.StatusOK, contentType, export.Archive)
+}
+
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	account, err := h.service.ScheduleDeletion(currentUserId, req.Password, req.Blogs, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, user.ErrDeletionScheduled):
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		case errors.Is(err, user.ErrIncorrectPassword):
+			utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error scheduling account deletion")
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Your account will be deleted at the end of the grace period. Sign in and cancel before then to keep it",
+		"deletion_scheduled_at": account.DeletionScheduledAt,
+	})
+}
+
+func (h *Handler) CancelAccountDeletion(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.CancelDeletion(currentUserId, c.ClientIP()); err != nil {
+		if errors.Is(err, user.ErrDeletionNotScheduled) {
+			utils.ErrorResponse(c, http.StatusConflict, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error cancelling account deletion")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
 
+// tooManyMailRequests answers a request that would send mail too often.
+func tooManyMailRequests(c *gin.Context, locked *user.LockedError) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	utils.ErrorResponse(c, http.StatusTooManyRequests, fmt.Sprintf("Too many emails requested, try again in %d seconds", int(math.Ceil(locked.RetryAfter.Seconds()))))
 }
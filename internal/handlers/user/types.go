@@ -1,17 +1,80 @@
 package user
 
-type SignUpRequest struct{
-	Email string `json:"email" binding:"required"`
-	Name string `json:"name" binding:"required"`
-	Password string `json:"password" binding:"required"`
-
+type SignUpRequest struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Name     string `json:"name" binding:"required,notblank,min=2,max=100"`
+	Password string `json:"password" binding:"required,password"`
 }
 
-type SignInRequest struct{
-	Email string `json:"email" binding:"required"`
-	Password string `json:"password" binding:"required"`
+type SignInRequest struct {
+	Email    string `json:"email" binding:"required,email,max=254"`
+	Password string `json:"password" binding:"required,max=72"`
 }
 
-type FollowRequest struct{
+type FollowRequest struct {
 	TargetUserIdParam uint `json:"targetUserIdParam" binding:"required"`
-}
\ No newline at end of file
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email,max=254"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required,max=72"`
+	NewPassword     string `json:"new_password" binding:"required,password"`
+}
+
+type TwoFactorSignInRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required,max=16"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required,max=16"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required,max=72"`
+	Code     string `json:"code" binding:"required,max=16"`
+}
+
+type ExportRequest struct {
+	Format string `json:"format" binding:"omitempty,oneof=json zip"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required,max=72"`
+	Blogs    string `json:"blogs" binding:"required,oneof=delete reassign"`
+}
+
+type PrivacyRequest struct {
+	Private *bool `json:"private" binding:"required"`
+}
+
+type HandleRequest struct {
+	Handle string `json:"handle" binding:"required,handle"`
+}
+
+type SearchUsersRequest struct {
+	Query string `form:"q" binding:"required,notblank,max=100"`
+	Skip  int    `form:"skip" binding:"min=0"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+type SuggestionsRequest struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=50"`
+}
+
+type PageRequest struct {
+	Skip  int `form:"skip" binding:"min=0"`
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,137 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/webhook"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type Handler struct {
+	service *webhook.Service
+}
+
+func NewHandler(service *webhook.Service) *Handler {
+	return &Handler{service: service}
+}
+
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	created, secret, err := h.service.CreateWebhook(currentUserId, req.URL, req.Events, req.Global)
+	if err != nil {
+		switch {
+		case errors.Is(err, webhook.ErrInvalidWebhookURL), errors.Is(err, webhook.ErrTooManyWebhooks):
+			utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, webhook.ErrGlobalAdminOnly):
+			utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		default:
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Error creating webhook")
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"secret":  secret,
+		"webhook": created.ToResponse(),
+		"message": "Copy this signing secret now, it won't be shown again",
+	})
+}
+
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	webhooks, err := h.service.ListWebhooks(currentUserId)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting webhooks")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	webhookId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	if err := h.service.DeleteWebhook(currentUserId, uint(webhookId)); err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error deleting webhook")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+func (h *Handler) ListDeliveries(c *gin.Context) {
+	webhookId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	var req ListDeliveriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.ValidationErrorResponse(c, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 20
+	}
+	deliveries, total, err := h.service.ListDeliveries(currentUserId, uint(webhookId), req.Skip, req.Limit)
+	if err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error getting deliveries")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      total,
+	})
+}
+
+func (h *Handler) Redeliver(c *gin.Context) {
+	webhookId, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid webhook id")
+		return
+	}
+	deliveryId, err := strconv.ParseUint(c.Param("deliveryId"), 10, 32)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Invalid delivery id")
+		return
+	}
+	userId, _ := c.Get("userID")
+	currentUserId := userId.(uint)
+
+	delivery, err := h.service.Redeliver(currentUserId, uint(webhookId), uint(deliveryId))
+	if err != nil {
+		if errors.Is(err, webhook.ErrWebhookNotFound) || errors.Is(err, webhook.ErrDeliveryNotFound) {
+			utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+			return
+		}
+		utils.ErrorResponse(c, http.StatusInternalServerError, "Error redelivering")
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"delivery": delivery})
+}
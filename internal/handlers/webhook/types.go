@@ -0,0 +1,12 @@
+package webhook
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url,max=2000"`
+	Events []string `json:"events" binding:"required,min=1,unique,dive,webhookevent"`
+	Global bool     `json:"global"`
+}
+
+type ListDeliveriesRequest struct {
+	Skip  int `form:"skip" binding:"min=0"`
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
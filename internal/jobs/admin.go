@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrJobNotFound     = errors.New("job not found")
+	ErrJobNotRetryable = errors.New("only dead or waiting jobs can be retried")
+	ErrJobDuplicate    = errors.New("another job with the same unique key is already queued")
+)
+
+type Filter struct {
+	Status string
+	Kind   string
+	Skip   int
+	Limit  int
+}
+
+// KindStats counts a kind's jobs by status.
+type KindStats struct {
+	Kind   string `json:"kind"`
+	Status string `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+func (q *Queue) ListJobs(filter Filter) ([]models.Job, int64, error) {
+	query := q.db.Model(&models.Job{})
+	if filter.Status != "" {
+		query = query.Where("status=?", filter.Status)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind=?", filter.Kind)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []models.Job
+	err := query.Order("id DESC").Offset(filter.Skip).Limit(filter.Limit).Find(&jobs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+func (q *Queue) GetJob(id uint) (*models.Job, error) {
+	var job models.Job
+	err := q.db.First(&job, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RetryJob runs a dead job again with fresh attempts, or a job waiting out
+// its backoff right away.
+func (q *Queue) RetryJob(id uint) (*models.Job, error) {
+	job, err := q.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.JobDead && job.Status != models.JobQueued {
+		return nil, ErrJobNotRetryable
+	}
+	if job.UniqueKey != nil && job.Status == models.JobDead {
+		var live int64
+		err := q.db.Model(&models.Job{}).
+			Where("unique_key=? AND id<>? AND status IN ?", *job.UniqueKey, id, []string{models.JobQueued, models.JobRunning}).
+			Count(&live).Error
+		if err != nil {
+			return nil, err
+		}
+		if live > 0 {
+			return nil, ErrJobDuplicate
+		}
+	}
+	err = q.db.Model(&models.Job{}).
+		Where("id=? AND status IN ?", id, []string{models.JobDead, models.JobQueued}).
+		Updates(map[string]interface{}{
+			"status":       models.JobQueued,
+			"attempts":     0,
+			"run_at":       time.Now(),
+			"completed_at": nil,
+		}).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrJobDuplicate
+		}
+		return nil, err
+	}
+	q.Wake()
+	return q.GetJob(id)
+}
+
+func (q *Queue) Stats() ([]KindStats, error) {
+	var stats []KindStats
+	err := q.db.Model(&models.Job{}).
+		Select("kind, status, COUNT(*) AS count").
+		Group("kind, status").
+		Order("kind, status").
+		Scan(&stats).Error
+	return stats, err
+}
@@ -0,0 +1,340 @@
+// Package jobs is a durable background job queue stored in Postgres.
+// Workers claim jobs with SKIP LOCKED, so any number of replicas can share
+// the queue.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// JobTimeout is how long a handler gets before its context is cancelled,
+// and so the longest Run takes to return once its context is done.
+const JobTimeout = 5 * time.Minute
+
+const (
+	pollInterval     = 5 * time.Second
+	maintainInterval = 15 * time.Second
+	// running jobs locked longer than this belong to a worker that died
+	lockTimeout = 2 * JobTimeout
+
+	defaultMaxAttempts = 5
+	firstBackoff       = 10 * time.Second
+	maxBackoff         = time.Hour
+
+	// finished jobs, dead ones included, are kept this long for inspection
+	retention = 7 * 24 * time.Hour
+)
+
+type handler struct {
+	run func(ctx context.Context, payload []byte) error
+}
+
+type schedule struct {
+	kind  string
+	every time.Duration
+}
+
+// Queue runs registered handlers for queued jobs. Handlers and schedules
+// must all be registered before Run.
+type Queue struct {
+	db        *gorm.DB
+	workers   int
+	handlers  map[string]handler
+	schedules []schedule
+	wake      chan struct{}
+}
+
+func NewQueue(db *gorm.DB, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		db:       db,
+		workers:  workers,
+		handlers: map[string]handler{},
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Handle registers fn for jobs of kind, decoding their payload into T.
+// Handlers must be idempotent: a job whose worker dies is run again.
+func Handle[T any](q *Queue, kind string, fn func(ctx context.Context, payload T) error) {
+	if _, ok := q.handlers[kind]; ok {
+		panic(fmt.Sprintf("jobs: handler for %q registered twice", kind))
+	}
+	q.handlers[kind] = handler{
+		run: func(ctx context.Context, payload []byte) error {
+			var p T
+			if err := json.Unmarshal(payload, &p); err != nil {
+				return err
+			}
+			return fn(ctx, p)
+		},
+	}
+}
+
+// Every runs the job kind once per interval across all replicas. Each run
+// is enqueued for the next interval boundary under a key unique to it.
+func (q *Queue) Every(kind string, interval time.Duration) {
+	q.schedules = append(q.schedules, schedule{kind: kind, every: interval})
+}
+
+type options struct {
+	runAt       time.Time
+	uniqueKey   *string
+	maxAttempts int
+}
+
+type Option func(*options)
+
+// Delay runs the job no sooner than d from now.
+func Delay(d time.Duration) Option {
+	return func(o *options) { o.runAt = time.Now().Add(d) }
+}
+
+// RunAt runs the job no sooner than t.
+func RunAt(t time.Time) Option {
+	return func(o *options) { o.runAt = t }
+}
+
+// Unique drops the job if another queued or running job has key.
+func Unique(key string) Option {
+	return func(o *options) { o.uniqueKey = &key }
+}
+
+func MaxAttempts(n int) Option {
+	return func(o *options) { o.maxAttempts = n }
+}
+
+// Enqueue adds a job through db, which may be a transaction so the job is
+// only queued if the surrounding change commits. It reports whether the
+// job was added, which is false when Unique found a duplicate.
+func Enqueue(db *gorm.DB, kind string, payload interface{}, opts ...Option) (bool, error) {
+	o := options{runAt: time.Now(), maxAttempts: defaultMaxAttempts}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+	result := db.Clauses(clause.OnConflict{
+		Columns:     []clause.Column{{Name: "unique_key"}},
+		TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "status IN ('queued', 'running')"}}},
+		DoNothing:   true,
+	}).Create(&models.Job{
+		Kind:        kind,
+		Payload:     string(body),
+		Status:      models.JobQueued,
+		UniqueKey:   o.uniqueKey,
+		MaxAttempts: o.maxAttempts,
+		RunAt:       o.runAt,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Enqueue adds a job and wakes a worker on this replica.
+func (q *Queue) Enqueue(kind string, payload interface{}, opts ...Option) error {
+	added, err := Enqueue(q.db, kind, payload, opts...)
+	if added {
+		q.Wake()
+	}
+	return err
+}
+
+// Wake makes an idle worker look for jobs now instead of at its next poll.
+// Call it after committing a transaction that used Enqueue.
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run works the queue until ctx is cancelled, then stops claiming jobs and
+// returns once the jobs in progress have finished, within JobTimeout.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.maintain(ctx)
+	}()
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		job, err := q.claim()
+		if err != nil {
+			log.Printf("failed to claim job: %v", err)
+		}
+		if job != nil {
+			q.execute(job)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// claim takes the next due job, or returns nil if there is none. Only
+// kinds this replica can handle are claimed.
+func (q *Queue) claim() (*models.Job, error) {
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	var jobs []models.Job
+	err := q.db.Raw(`
+		UPDATE jobs SET status = ?, locked_at = ?, attempts = attempts + 1, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ? AND kind IN ?
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.JobRunning, now, now, models.JobQueued, now, kinds).Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// execute runs job with a context of its own, so shutting down lets it
+// finish instead of cutting it off.
+func (q *Queue) execute(job *models.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), JobTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, jobKey{}, job)
+
+	err := q.runHandler(ctx, job)
+	now := time.Now()
+	updates := map[string]interface{}{"locked_at": nil}
+	switch {
+	case err == nil:
+		updates["status"] = models.JobSucceeded
+		updates["completed_at"] = now
+		updates["last_error"] = ""
+	case job.Attempts >= job.MaxAttempts:
+		log.Printf("job %d (%s) is dead after %d attempts: %v", job.ID, job.Kind, job.Attempts, err)
+		updates["status"] = models.JobDead
+		updates["completed_at"] = now
+		updates["last_error"] = err.Error()
+	default:
+		updates["status"] = models.JobQueued
+		updates["run_at"] = now.Add(backoff(job.Attempts))
+		updates["last_error"] = err.Error()
+	}
+	if err := q.db.Model(&models.Job{}).Where("id=?", job.ID).Updates(updates).Error; err != nil {
+		log.Printf("failed to record job %d: %v", job.ID, err)
+	}
+}
+
+func (q *Queue) runHandler(ctx context.Context, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return q.handlers[job.Kind].run(ctx, []byte(job.Payload))
+}
+
+// maintain enqueues scheduled jobs, requeues jobs of workers that died and
+// deletes old finished jobs.
+func (q *Queue) maintain(ctx context.Context) {
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+	for {
+		q.enqueueScheduled()
+		q.reapStale()
+		q.deleteFinished()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (q *Queue) enqueueScheduled() {
+	now := time.Now()
+	for _, s := range q.schedules {
+		next := now.Truncate(s.every).Add(s.every)
+		key := fmt.Sprintf("%s@%d", s.kind, next.Unix())
+		if _, err := Enqueue(q.db, s.kind, struct{}{}, RunAt(next), Unique(key), MaxAttempts(1)); err != nil {
+			log.Printf("failed to schedule %s: %v", s.kind, err)
+		}
+	}
+}
+
+func (q *Queue) reapStale() {
+	now := time.Now()
+	err := q.db.Exec(`
+		UPDATE jobs SET
+			status = CASE WHEN attempts >= max_attempts THEN ? ELSE ? END,
+			completed_at = CASE WHEN attempts >= max_attempts THEN ?::timestamptz END,
+			last_error = 'worker stopped while running the job',
+			locked_at = NULL, run_at = ?, updated_at = ?
+		WHERE status = ? AND locked_at < ?`,
+		models.JobDead, models.JobQueued, now, now, now, models.JobRunning, now.Add(-lockTimeout)).Error
+	if err != nil {
+		log.Printf("failed to requeue stale jobs: %v", err)
+	}
+}
+
+func (q *Queue) deleteFinished() {
+	err := q.db.Where("status IN ? AND completed_at < ?", []string{models.JobSucceeded, models.JobDead}, time.Now().Add(-retention)).
+		Delete(&models.Job{}).Error
+	if err != nil {
+		log.Printf("failed to delete finished jobs: %v", err)
+	}
+}
+
+func backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		if d := firstBackoff << (attempts - 1); d < maxBackoff {
+			wait = d
+		}
+	}
+	return wait
+}
+
+type jobKey struct{}
+
+// FinalAttempt reports whether the job being handled will be dead if this
+// attempt fails, so handlers can record the failure for users.
+func FinalAttempt(ctx context.Context) bool {
+	job, ok := ctx.Value(jobKey{}).(*models.Job)
+	return ok && job.Attempts >= job.MaxAttempts
+}
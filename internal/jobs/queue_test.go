@@ -0,0 +1,240 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, firstBackoff},
+		{2, 2 * firstBackoff},
+		{3, 4 * firstBackoff},
+		{9, 256 * firstBackoff},
+		{10, maxBackoff},
+		// large attempt counts must not overflow the shift
+		{19, maxBackoff},
+		{64, maxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			if got := backoff(tt.attempts); got != tt.want {
+				t.Errorf("backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFinalAttempt(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{"outside a job", context.Background(), false},
+		{"attempts left", context.WithValue(context.Background(), jobKey{}, &models.Job{Attempts: 1, MaxAttempts: 3}), false},
+		{"last attempt", context.WithValue(context.Background(), jobKey{}, &models.Job{Attempts: 3, MaxAttempts: 3}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FinalAttempt(tt.ctx); got != tt.want {
+				t.Errorf("FinalAttempt = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunHandler(t *testing.T) {
+	q := NewQueue(nil, 1)
+	type payload struct {
+		N int `json:"n"`
+	}
+	Handle(q, "test.ok", func(ctx context.Context, p payload) error {
+		if p.N != 7 {
+			return errors.New("payload was not decoded")
+		}
+		return nil
+	})
+	Handle(q, "test.panic", func(ctx context.Context, p payload) error {
+		panic("boom")
+	})
+
+	tests := []struct {
+		name    string
+		job     models.Job
+		wantErr bool
+	}{
+		{"decodes the payload", models.Job{Kind: "test.ok", Payload: `{"n":7}`}, false},
+		{"bad payload", models.Job{Kind: "test.ok", Payload: `{"n":"seven"}`}, true},
+		{"panic becomes an error", models.Job{Kind: "test.panic", Payload: `{}`}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.runHandler(context.Background(), &tt.job)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runHandler = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func openQueue(t *testing.T) (*Queue, *gorm.DB) {
+	t.Helper()
+	db := dbtest.Open(t, &models.Job{})
+	// the partial index database.Migrate creates, which Unique relies on
+	err := db.Exec("CREATE UNIQUE INDEX idx_jobs_unique_key ON jobs (unique_key) WHERE status IN ('queued', 'running')").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewQueue(db, 1), db
+}
+
+func TestClaimRetryAndDeath(t *testing.T) {
+	q, db := openQueue(t)
+	failures := 0
+	Handle(q, "test.flaky", func(ctx context.Context, _ struct{}) error {
+		failures++
+		return errors.New("still failing")
+	})
+
+	if _, err := Enqueue(db, "test.unhandled", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Enqueue(db, "test.flaky", struct{}{}, MaxAttempts(2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Enqueue(db, "test.flaky", struct{}{}, Delay(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name         string
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"first failure is retried later", models.JobQueued, 1},
+		{"last failure kills the job", models.JobDead, 2},
+	}
+	var jobId uint
+	for _, step := range steps {
+		job, err := q.claim()
+		if err != nil {
+			t.Fatalf("%s: claim: %v", step.name, err)
+		}
+		if job == nil {
+			t.Fatalf("%s: nothing claimed", step.name)
+		}
+		// only the due job of a handled kind is claimed
+		if job.Kind != "test.flaky" || job.Status != models.JobRunning || job.LockedAt == nil {
+			t.Fatalf("%s: claimed %+v", step.name, job)
+		}
+		jobId = job.ID
+		q.execute(job)
+
+		stored, err := q.GetJob(jobId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != step.wantStatus || stored.Attempts != step.wantAttempts || stored.LastError != "still failing" {
+			t.Fatalf("%s: job = %+v", step.name, stored)
+		}
+		if stored.Status == models.JobQueued {
+			if wait := time.Until(stored.RunAt); wait < firstBackoff-time.Second || wait > firstBackoff {
+				t.Fatalf("%s: retried in %s, want %s", step.name, wait, firstBackoff)
+			}
+			// the job is waiting out its backoff
+			if job, err := q.claim(); err != nil || job != nil {
+				t.Fatalf("%s: claimed %+v, %v during backoff", step.name, job, err)
+			}
+			if err := db.Model(&models.Job{}).Where("id=?", jobId).Update("run_at", time.Now()).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if failures != 2 {
+		t.Fatalf("handler ran %d times, want 2", failures)
+	}
+
+	retried, err := q.RetryJob(jobId)
+	if err != nil {
+		t.Fatalf("RetryJob: %v", err)
+	}
+	if retried.Status != models.JobQueued || retried.Attempts != 0 {
+		t.Fatalf("retried job = %+v", retried)
+	}
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	q, db := openQueue(t)
+	Handle(q, "test.ok", func(ctx context.Context, _ struct{}) error { return nil })
+
+	added, err := Enqueue(db, "test.ok", struct{}{}, Unique("once"))
+	if err != nil || !added {
+		t.Fatalf("first Enqueue = %v, %v", added, err)
+	}
+	added, err = Enqueue(db, "test.ok", struct{}{}, Unique("once"))
+	if err != nil || added {
+		t.Fatalf("duplicate Enqueue = %v, %v", added, err)
+	}
+
+	job, err := q.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim = %+v, %v", job, err)
+	}
+	// a running job still holds its key
+	if added, err := Enqueue(db, "test.ok", struct{}{}, Unique("once")); err != nil || added {
+		t.Fatalf("Enqueue while running = %v, %v", added, err)
+	}
+	q.execute(job)
+	// a finished one doesn't
+	if added, err := Enqueue(db, "test.ok", struct{}{}, Unique("once")); err != nil || !added {
+		t.Fatalf("Enqueue after finishing = %v, %v", added, err)
+	}
+}
+
+func TestDeleteFinished(t *testing.T) {
+	q, db := openQueue(t)
+	old := time.Now().Add(-retention - time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	jobs := []models.Job{
+		{Kind: "old.succeeded", Status: models.JobSucceeded, CompletedAt: &old},
+		{Kind: "old.dead", Status: models.JobDead, CompletedAt: &old},
+		{Kind: "recent.succeeded", Status: models.JobSucceeded, CompletedAt: &recent},
+		{Kind: "recent.dead", Status: models.JobDead, CompletedAt: &recent},
+		{Kind: "queued", Status: models.JobQueued},
+	}
+	for i := range jobs {
+		jobs[i].Payload = "{}"
+		jobs[i].MaxAttempts = 1
+		jobs[i].RunAt = old
+	}
+	if err := db.Create(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	q.deleteFinished()
+
+	var kinds []string
+	if err := db.Model(&models.Job{}).Order("id").Pluck("kind", &kinds).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"recent.succeeded", "recent.dead", "queued"}
+	if len(kinds) != len(want) {
+		t.Fatalf("kept %v, want %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("kept %v, want %v", kinds, want)
+		}
+	}
+}
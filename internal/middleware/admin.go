@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminChecker interface {
+	IsAdmin(userID uint) (bool, error)
+}
+
+// RequireAdmin only lets admins through. It must run after AuthMiddleware.
+func RequireAdmin(checker AdminChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		admin, err := checker.IsAdmin(userID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+			c.Abort()
+			return
+		}
+		if !admin {
+			utils.ErrorResponse(c, http.StatusForbidden, "This action is only available to admins")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
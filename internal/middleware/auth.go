@@ -1,13 +1,118 @@
 package middleware
 
 import (
+	"errors"
+	"net/http"
 	"strings"
 
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/token"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// TokenVersionChecker reports the token version a user's JWTs must carry.
+// Tokens issued before a password change carry an older version.
+type TokenVersionChecker interface {
+	GetTokenVersion(userID uint) (int, error)
+}
+
+type AccessTokenValidator interface {
+	ValidateToken(plain string) (*models.PersonalAccessToken, error)
+}
+
+// SessionToucher checks that a session has not been signed out and records
+// that it was just used.
+type SessionToucher interface {
+	Touch(sessionID string, userID uint) error
+}
+
+const (
+	AuthMethodSession     = "session"
+	AuthMethodAccessToken = "access_token"
+)
+
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// Principal is who a request is authenticated as.
+type Principal struct {
+	UserID uint
+	Email  string
+	Method string
+	// SessionID is empty for access tokens.
+	SessionID string
+	// Scopes is nil for sign-in sessions, which may do anything.
+	Scopes []string
+}
+
+// HasScope reports whether the principal may act within scope. Sign-in
+// sessions may do anything.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Method == AuthMethodSession {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Authenticator struct {
+	keys     *utils.KeySet
+	users    TokenVersionChecker
+	tokens   AccessTokenValidator
+	sessions SessionToucher
+}
+
+func NewAuthenticator(keys *utils.KeySet, users TokenVersionChecker, tokens AccessTokenValidator, sessions SessionToucher) *Authenticator {
+	return &Authenticator{
+		keys:     keys,
+		users:    users,
+		tokens:   tokens,
+		sessions: sessions,
+	}
+}
+
+// Authenticate accepts either a sign-in JWT or a personal access token.
+func (a *Authenticator) Authenticate(tokenString string) (*Principal, error) {
+	if token.IsAccessToken(tokenString) {
+		pat, err := a.tokens.ValidateToken(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{
+			UserID: pat.UserID,
+			Method: AuthMethodAccessToken,
+			Scopes: pat.ScopeList(),
+		}, nil
+	}
+
+	claims, err := utils.ValidateToken(tokenString, a.keys)
+	if err != nil {
+		return nil, err
+	}
+	version, err := a.users.GetTokenVersion(claims.UserID)
+	if err != nil || version != claims.TokenVersion {
+		return nil, errInvalidCredentials
+	}
+	// tokens issued before sessions were recorded carry no id; they are still
+	// covered by the token version and expire on their own
+	if claims.ID != "" {
+		if err := a.sessions.Touch(claims.ID, claims.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return &Principal{
+		UserID:    claims.UserID,
+		Email:     claims.Email,
+		Method:    AuthMethodSession,
+		SessionID: claims.ID,
+	}, nil
+}
+
+func AuthMiddleware(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -17,16 +122,82 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, err := utils.ValidateToken(tokenString, jwtSecret)
+		principal, err := auth.Authenticate(tokenString)
 		if err != nil {
 			utils.ErrorResponse(c, 403, "Token expired or invalid. Please login again")
 			c.Abort()
 			return
 		}
 
-		c.Set("userID", claims.UserID)
-		c.Set("email", claims.Email)
+		c.Set("userID", principal.UserID)
+		c.Set("email", principal.Email)
+		c.Set("principal", principal)
+		c.Set("sessionID", principal.SessionID)
+
+		c.Next()
+	}
+}
 
+// StreamTokenFromQuery lets EventSource and WebSocket clients, which can't
+// set headers, pass their token as ?access_token=. The token is moved into
+// the Authorization header for AuthMiddleware and removed from the URL, so
+// it must run before the request logger to keep tokens out of the logs.
+// Ordinary requests are left alone.
+func StreamTokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		streaming := strings.Contains(c.GetHeader("Accept"), "text/event-stream") ||
+			strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+		query := c.Request.URL.Query()
+		tokenString := query.Get("access_token")
+		if !streaming || tokenString == "" {
+			c.Next()
+			return
+		}
+		if c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+tokenString)
+		}
+		query.Del("access_token")
+		c.Request.URL.RawQuery = query.Encode()
+		c.Next()
+	}
+}
+
+func getPrincipal(c *gin.Context) *Principal {
+	if p, ok := c.Get("principal"); ok {
+		return p.(*Principal)
+	}
+	return nil
+}
+
+// RequireScope lets sign-in sessions through and checks that access tokens
+// were granted scope. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := getPrincipal(c)
+		if principal == nil {
+			utils.ErrorResponse(c, http.StatusForbidden, "No token found")
+			c.Abort()
+			return
+		}
+		if principal.HasScope(scope) {
+			c.Next()
+			return
+		}
+		utils.ErrorResponse(c, http.StatusForbidden, "Access token is missing the "+scope+" scope")
+		c.Abort()
+	}
+}
+
+// RequireSession keeps access tokens away from account management such as
+// changing the password or minting more tokens.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := getPrincipal(c)
+		if principal == nil || principal.Method != AuthMethodSession {
+			utils.ErrorResponse(c, http.StatusForbidden, "This action requires signing in with a password")
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
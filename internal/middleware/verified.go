@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+type EmailVerificationChecker interface {
+	IsEmailVerified(userID uint) (bool, error)
+}
+
+// RequireVerifiedEmail rejects requests from users who have not confirmed
+// their email address. It must run after AuthMiddleware.
+func RequireVerifiedEmail(checker EmailVerificationChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		verified, err := checker.IsEmailVerified(userID)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusInternalServerError, "Internal Server Error")
+			c.Abort()
+			return
+		}
+		if !verified {
+			utils.ErrorResponse(c, http.StatusForbidden, "Please verify your email address first")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes a personal access token can be granted. Tokens from signing in
+// carry every scope.
+const (
+	ScopeReadBlogs     = "read:blogs"
+	ScopeWriteBlogs    = "write:blogs"
+	ScopeWriteComments = "write:comments"
+	ScopeWriteVotes    = "write:votes"
+	ScopeReadProfile   = "read:profile"
+	ScopeWriteFollows  = "write:follows"
+	ScopeNotifications = "read:notifications"
+)
+
+var TokenScopes = []string{
+	ScopeReadBlogs,
+	ScopeWriteBlogs,
+	ScopeWriteComments,
+	ScopeWriteVotes,
+	ScopeReadProfile,
+	ScopeWriteFollows,
+	ScopeNotifications,
+}
+
+func IsValidScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalAccessToken lets scripts act as a user without a password. Only the
+// SHA-256 of the token is stored; Prefix is kept so users can tell tokens
+// apart.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+type AccessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) ToResponse() AccessTokenResponse {
+	return AccessTokenResponse{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.ScopeList(),
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		CreatedAt:  t.CreatedAt,
+	}
+}
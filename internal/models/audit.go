@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// AuditLog records security-relevant events. UserID is empty when the event
+// can't be tied to an existing account.
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id" gorm:"index"`
+	Action    string    `json:"action" gorm:"not null;index"`
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// LoginThrottle counts recent failed sign-ins for one key, either an email
+// address ("email:...") or a client IP ("ip:...").
+type LoginThrottle struct {
+	Key           string    `gorm:"primaryKey"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"not null"`
+	LockedUntil   *time.Time
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Block cuts two users off from each other: neither sees the other's
+// content and the blocked user can't follow or interact with the blocker.
+type Block struct {
+	BlockerID uint      `json:"blocker_id" gorm:"primaryKey"`
+	BlockedID uint      `json:"blocked_id" gorm:"primaryKey;index"`
+	Blocked   User      `json:"-" gorm:"foreignKey:BlockedID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Mute hides the muted user's content from the muter only. The muted user
+// is not told and can still interact.
+type Mute struct {
+	MuterID   uint      `json:"muter_id" gorm:"primaryKey"`
+	MutedID   uint      `json:"muted_id" gorm:"primaryKey;index"`
+	Muted     User      `json:"-" gorm:"foreignKey:MutedID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RestrictedUserResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
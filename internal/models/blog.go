@@ -6,20 +6,32 @@ import (
 )
 
 type Blog struct {
-    ID        uint           `json:"id" gorm:"primaryKey"`
-    Title     string         `json:"title" gorm:"not null;index"`
-    Content   string         `json:"content" gorm:"type:text;not null"`
-    Genre     string         `json:"genre" gorm:"not null;index"`
-    Views     int            `json:"views" gorm:"default:0"`
-    AuthorID  uint           `json:"author_id" gorm:"not null;index"`
-    Author    User           `json:"author" gorm:"foreignKey:AuthorID"`
-    Votes     []Vote         `json:"votes,omitempty" gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE"`
-    Comments  []Comment      `json:"comments,omitempty" gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE"`
-    CreatedAt time.Time      `json:"created_at"`
-    UpdatedAt time.Time      `json:"updated_at"`
-    DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+    ID           uint           `json:"id" gorm:"primaryKey"`
+    Title        string         `json:"title" gorm:"not null;index"`
+    Content      string         `json:"content" gorm:"type:text;not null"`
+    Genre        string         `json:"genre" gorm:"not null;index"`
+    Views        int            `json:"views" gorm:"default:0"`
+    AuthorID     uint           `json:"author_id" gorm:"not null;index"`
+    Author       User           `json:"author" gorm:"foreignKey:AuthorID"`
+    Votes        []Vote         `json:"votes,omitempty" gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE"`
+    Comments     []Comment      `json:"comments,omitempty" gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE"`
+    Tags         []BlogTag      `json:"tags,omitempty" gorm:"foreignKey:BlogID;constraint:OnDelete:CASCADE"`
+    // kept by the counters subscribers, never written with the blog
+    VoteCount    int64          `json:"vote_count" gorm:"->;not null;default:0"`
+    CommentCount int64          `json:"comment_count" gorm:"->;not null;default:0"`
+    // kept by the search subscribers from BlogSearchDocument
+    SearchVector string         `json:"-" gorm:"->:false;<-:false;type:tsvector"`
+    CreatedAt    time.Time      `json:"created_at"`
+    UpdatedAt    time.Time      `json:"updated_at"`
+    DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// BlogSearchDocument is the SQL for a blog's search vector, in statements
+// over blogs. Title and tags weigh more than the content.
+const BlogSearchDocument = `setweight(to_tsvector('simple', blogs.title || ' ' ||
+        coalesce((SELECT string_agg(tag, ' ') FROM blog_tags WHERE blog_tags.blog_id = blogs.id), '')), 'A') ||
+    setweight(to_tsvector('simple', blogs.content), 'B')`
+
 type BlogResponse struct {
     ID        uint         `json:"id"`
     Title     string       `json:"title"`
@@ -33,12 +45,14 @@ type BlogResponse struct {
 }
 
 type BlogListResponse struct {
-    ID        uint         `json:"id"`
-    Title     string       `json:"title"`
-    Genre     string       `json:"genre"`
-    Views     int          `json:"views"`
-    VoteCount int64        `json:"votes"`
-    AuthorID  uint         `json:"author_id"`
-    Author    UserResponse `json:"author"`
-    CreatedAt time.Time    `json:"created_at"`
+    ID           uint         `json:"id"`
+    Title        string       `json:"title"`
+    Genre        string       `json:"genre"`
+    Views        int          `json:"views"`
+    VoteCount    int64        `json:"votes"`
+    CommentCount int64        `json:"comments"`
+    AuthorID     uint         `json:"author_id"`
+    Author       UserResponse `json:"author"`
+    CreatedAt    time.Time    `json:"created_at"`
+    UpdatedAt    time.Time    `json:"updated_at"`
 }
\ No newline at end of file
@@ -10,6 +10,8 @@ type Comment struct {
     Comment   string         `json:"comment" gorm:"type:text;not null"`
     AuthorID  uint           `json:"author_id" gorm:"not null;index"`
     BlogID    uint           `json:"blog_id" gorm:"not null;index"`
+    // ParentID is set on replies to another comment on the same blog
+    ParentID  *uint          `json:"parent_id,omitempty" gorm:"index"`
     Author    User           `json:"author" gorm:"foreignKey:AuthorID"`
     Blog      Blog           `json:"-" gorm:"foreignKey:BlogID"`
     CreatedAt time.Time      `json:"created_at"`
@@ -20,6 +22,7 @@ type Comment struct {
 type CommentResponse struct {
     ID        uint         `json:"id"`
     Comment   string       `json:"comment"`
+    ParentID  *uint        `json:"parent_id,omitempty"`
     AuthorID  uint         `json:"author_id"`
     Author    UserResponse `json:"author"`
     CreatedAt time.Time    `json:"created_at"`
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is
+// built in the background and kept in the database until it expires.
+type DataExport struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"-" gorm:"not null;index"`
+	Format      string     `json:"format" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null;index"`
+	Archive     []byte     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at" gorm:"index"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// FollowRequest is a pending follow of a private account. Approving it
+// turns it into a Follows row.
+type FollowRequest struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	RequesterID uint      `json:"requester_id" gorm:"not null;uniqueIndex:idx_follow_request_pair"`
+	TargetID    uint      `json:"target_id" gorm:"not null;uniqueIndex:idx_follow_request_pair;index"`
+	Requester   User      `json:"-" gorm:"foreignKey:RequesterID"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FollowRequestResponse struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -14,7 +14,26 @@ type Follows struct {
     DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// FollowResponse is one entry of a follower or following list. FollowsYou
+// and IsFollowing describe the entry's relationship to whoever is viewing
+// the list.
 type FollowResponse struct {
-    ID   uint   `json:"id"`
-    Name string `json:"name"`
-}
\ No newline at end of file
+    ID          uint      `json:"id"`
+    Name        string    `json:"name"`
+    Handle      string    `json:"handle,omitempty"`
+    FollowedAt  time.Time `json:"followed_at"`
+    FollowsYou  bool      `json:"follows_you"`
+    IsFollowing bool      `json:"is_following"`
+}
+
+// FollowSummary holds a profile's follow counts and, when someone else is
+// looking, how they relate to it.
+type FollowSummary struct {
+    UserID      uint  `json:"user_id"`
+    Followers   int64 `json:"followers"`
+    Following   int64 `json:"following"`
+    Mutuals     int64 `json:"mutuals"`
+    FollowsYou  bool  `json:"follows_you"`
+    IsFollowing bool  `json:"is_following"`
+    Requested   bool  `json:"requested"`
+}
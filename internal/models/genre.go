@@ -0,0 +1,40 @@
+package models
+
+// Genres lists every genre a blog can be filed under. The frontend offers
+// the same list plus "All" for filtering.
+var Genres = []string{
+	"Technology",
+	"Science",
+	"Politics",
+	"Business",
+	"Health",
+	"Sports",
+	"Entertainment",
+	"Lifestyle",
+	"Travel",
+	"Education",
+	"Fiction",
+	"Poetry",
+	"Opinion",
+	"Other",
+}
+
+func IsValidGenre(genre string) bool {
+	for _, g := range Genres {
+		if g == genre {
+			return true
+		}
+	}
+	return false
+}
+
+// AddGenres accepts genres that blogs were already filed under before the
+// list existed, so those blogs can still be edited. It must run before
+// requests are served.
+func AddGenres(genres ...string) {
+	for _, g := range genres {
+		if g != "" && !IsValidGenre(g) {
+			Genres = append(Genres, g)
+		}
+	}
+}
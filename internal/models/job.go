@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Job states. Failed attempts go back to queued until MaxAttempts is used
+// up, then the job is dead and waits for an admin to retry it.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job is a unit of background work. Kind picks the handler and Payload is
+// its JSON argument. Only one queued or running job may hold a UniqueKey.
+// Payloads are kept out of the admin API; they should only carry ids.
+type Job struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Kind        string     `json:"kind" gorm:"not null;index"`
+	Payload     string     `json:"-" gorm:"type:text;not null"`
+	Status      string     `json:"status" gorm:"not null;index"`
+	UniqueKey   *string    `json:"unique_key,omitempty"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	MaxAttempts int        `json:"max_attempts" gorm:"not null"`
+	RunAt       time.Time  `json:"run_at" gorm:"not null"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty" gorm:"type:text"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// LiveReader is one open live connection to a blog. Rows are refreshed
+// while the connection lives, so stale ones left by a crashed replica stop
+// counting once SeenAt is old enough.
+type LiveReader struct {
+	ConnectionID string    `gorm:"primaryKey"`
+	BlogID       uint      `gorm:"not null;index"`
+	UserID       uint      `gorm:"not null"`
+	SeenAt       time.Time `gorm:"not null;index"`
+}
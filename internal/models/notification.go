@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Notification types.
+const (
+	NotifyFollow        = "follow"
+	NotifyFollowRequest = "follow_request"
+	NotifyVote          = "vote"
+	NotifyComment       = "comment"
+	NotifyReply         = "reply"
+	NotifyMention       = "mention"
+	NotifyNewPost       = "new_post"
+)
+
+// Notification tells a user that someone interacted with them. Repeats of
+// the same event share a GroupKey and are collapsed into one unread row,
+// with Actor being the most recent of ActorCount people.
+type Notification struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index:idx_notification_group"`
+	Type       string     `json:"type" gorm:"not null"`
+	GroupKey   string     `json:"-" gorm:"not null;index:idx_notification_group"`
+	ActorID    uint       `json:"actor_id" gorm:"not null;index"`
+	Actor      User       `json:"-" gorm:"foreignKey:ActorID"`
+	ActorCount int        `json:"actor_count" gorm:"not null;default:1"`
+	BlogID     *uint      `json:"blog_id,omitempty" gorm:"index"`
+	Blog       *Blog      `json:"-" gorm:"foreignKey:BlogID"`
+	CommentID  *uint      `json:"comment_id,omitempty"`
+	ReadAt     *time.Time `json:"read_at,omitempty" gorm:"index"`
+	// EmailOnly rows are kept out of the in-app list and only exist to be
+	// emailed. EmailDueAt is when the pending email should go out.
+	EmailOnly  bool       `json:"-" gorm:"not null;default:false"`
+	EmailDueAt *time.Time `json:"-" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// NotificationActor records everyone folded into a collapsed notification
+// so each person is only counted once.
+type NotificationActor struct {
+	NotificationID uint `gorm:"primaryKey"`
+	ActorID        uint `gorm:"primaryKey"`
+}
+
+type NotificationResponse struct {
+	ID         uint         `json:"id"`
+	Type       string       `json:"type"`
+	Message    string       `json:"message"`
+	Actor      UserResponse `json:"actor"`
+	ActorCount int          `json:"actor_count"`
+	BlogID     *uint        `json:"blog_id,omitempty"`
+	CommentID  *uint        `json:"comment_id,omitempty"`
+	Read       bool         `json:"read"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
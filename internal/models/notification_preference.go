@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// Delivery channels for a notification type.
+const (
+	ChannelInApp = "in_app"
+	ChannelEmail = "email"
+	ChannelAll   = "all"
+	ChannelNone  = "none"
+)
+
+// NotificationPreference says how a user wants to hear about each kind of
+// event. Users without a row get DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserID   uint   `json:"-" gorm:"primaryKey"`
+	Follows  string `json:"follows" gorm:"not null;default:in_app"`
+	Votes    string `json:"votes" gorm:"not null;default:in_app"`
+	Comments string `json:"comments" gorm:"not null;default:in_app"`
+	Replies  string `json:"replies" gorm:"not null;default:in_app"`
+	Mentions string `json:"mentions" gorm:"not null;default:in_app"`
+	Posts    string `json:"posts" gorm:"not null;default:in_app"`
+	// QuietHoursStart and QuietHoursEnd are "15:04" times in TimeZone during
+	// which no email is sent. Both are empty when quiet hours are off.
+	QuietHoursStart string    `json:"quiet_hours_start"`
+	QuietHoursEnd   string    `json:"quiet_hours_end"`
+	TimeZone        string    `json:"time_zone" gorm:"not null;default:UTC"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+func DefaultNotificationPreference(userId uint) NotificationPreference {
+	return NotificationPreference{
+		UserID:   userId,
+		Follows:  ChannelInApp,
+		Votes:    ChannelInApp,
+		Comments: ChannelInApp,
+		Replies:  ChannelInApp,
+		Mentions: ChannelInApp,
+		Posts:    ChannelInApp,
+		TimeZone: "UTC",
+	}
+}
+
+// Channel returns how notifications of notifyType are delivered.
+func (p *NotificationPreference) Channel(notifyType string) string {
+	switch notifyType {
+	case NotifyFollow, NotifyFollowRequest:
+		return p.Follows
+	case NotifyVote:
+		return p.Votes
+	case NotifyComment:
+		return p.Comments
+	case NotifyReply:
+		return p.Replies
+	case NotifyMention:
+		return p.Mentions
+	case NotifyNewPost:
+		return p.Posts
+	}
+	return ChannelInApp
+}
+
+// QuietUntil returns when the quiet hours t falls in end, or the zero time
+// if t is outside quiet hours.
+func (p *NotificationPreference) QuietUntil(t time.Time) time.Time {
+	if p.QuietHoursStart == "" || p.QuietHoursEnd == "" {
+		return time.Time{}
+	}
+	start, err := time.Parse("15:04", p.QuietHoursStart)
+	if err != nil {
+		return time.Time{}
+	}
+	end, err := time.Parse("15:04", p.QuietHoursEnd)
+	if err != nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+	var quiet bool
+	if from <= to {
+		quiet = now >= from && now < to
+	} else {
+		// the window wraps past midnight, e.g. 22:00-07:00
+		quiet = now >= from || now < to
+	}
+	if !quiet {
+		return time.Time{}
+	}
+	until := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+// NotificationPreferencesResponse adds the digest frequency, which lives on
+// the user, to the per-event settings.
+type NotificationPreferencesResponse struct {
+	NotificationPreference
+	Digests string `json:"digests"`
+}
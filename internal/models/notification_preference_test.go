@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestQuietUntil(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		zone       string
+		at         time.Time
+		want       time.Time
+	}{
+		{name: "off", zone: "UTC", at: utc(1, 10, 3, 0)},
+		{name: "half set", start: "22:00", zone: "UTC", at: utc(1, 10, 23, 0)},
+		{name: "unparseable", start: "10pm", end: "07:00", zone: "UTC", at: utc(1, 10, 23, 0)},
+
+		{name: "inside a daytime window", start: "09:00", end: "17:00", zone: "UTC", at: utc(1, 10, 10, 0), want: utc(1, 10, 17, 0)},
+		{name: "at the start", start: "09:00", end: "17:00", zone: "UTC", at: utc(1, 10, 9, 0), want: utc(1, 10, 17, 0)},
+		{name: "at the end", start: "09:00", end: "17:00", zone: "UTC", at: utc(1, 10, 17, 0)},
+		{name: "before a daytime window", start: "09:00", end: "17:00", zone: "UTC", at: utc(1, 10, 8, 59)},
+
+		// windows that wrap past midnight end on the following morning
+		{name: "before midnight", start: "22:00", end: "07:00", zone: "UTC", at: utc(1, 10, 23, 0), want: utc(1, 11, 7, 0)},
+		{name: "after midnight", start: "22:00", end: "07:00", zone: "UTC", at: utc(1, 11, 3, 0), want: utc(1, 11, 7, 0)},
+		{name: "wrapping window, at the end", start: "22:00", end: "07:00", zone: "UTC", at: utc(1, 11, 7, 0)},
+		{name: "wrapping window, midday", start: "22:00", end: "07:00", zone: "UTC", at: utc(1, 10, 12, 0)},
+		{name: "wrap across new year", start: "22:00", end: "07:00", zone: "UTC", at: time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC), want: utc(1, 1, 7, 0)},
+
+		// times are read in the user's zone
+		{name: "local evening", start: "22:00", end: "07:00", zone: "Europe/Berlin", at: utc(1, 10, 21, 30), want: utc(1, 11, 6, 0)},
+		{name: "not yet quiet locally", start: "22:00", end: "07:00", zone: "Europe/Berlin", at: utc(1, 10, 20, 30)},
+		{name: "unknown zone falls back to UTC", start: "22:00", end: "07:00", zone: "Mars/Olympus", at: utc(1, 10, 23, 0), want: utc(1, 11, 7, 0)},
+
+		// the night clocks change is an hour shorter or longer, but quiet
+		// hours still end at 07:00 local time
+		{name: "spring forward", start: "22:00", end: "07:00", zone: "Europe/Berlin", at: utc(3, 28, 21, 30), want: time.Date(2026, 3, 29, 7, 0, 0, 0, berlin)},
+		{name: "fall back", start: "22:00", end: "07:00", zone: "Europe/Berlin", at: utc(10, 24, 20, 30), want: time.Date(2026, 10, 25, 7, 0, 0, 0, berlin)},
+		{name: "inside the repeated hour", start: "01:00", end: "04:00", zone: "Europe/Berlin", at: utc(10, 25, 0, 30), want: utc(10, 25, 3, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NotificationPreference{QuietHoursStart: tt.start, QuietHoursEnd: tt.end, TimeZone: tt.zone}
+			if got := p.QuietUntil(tt.at); !got.Equal(tt.want) {
+				t.Errorf("QuietUntil(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it describes, so it exists exactly when the change does. The
+// dispatcher hands it to every subscriber at least once.
+type OutboxEvent struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	Type    string `json:"type" gorm:"not null;index"`
+	Payload string `json:"payload" gorm:"type:text;not null"`
+	// AvailableAt is when the event may next be dispatched; it is pushed
+	// back while a dispatcher holds the event and after failures.
+	AvailableAt time.Time  `json:"available_at" gorm:"not null;index"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0"`
+	LastError   string     `json:"last_error,omitempty"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty" gorm:"index"`
+	FailedAt    *time.Time `json:"failed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// OutboxHandled records that a subscriber has handled an event, so a retry
+// only reruns the subscribers that failed.
+type OutboxHandled struct {
+	EventID    uint      `gorm:"primaryKey"`
+	Subscriber string    `gorm:"primaryKey"`
+	CreatedAt  time.Time `json:"created_at"`
+}
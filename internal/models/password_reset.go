@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// PasswordResetToken stores only the SHA-256 of the token that was mailed to
+// the user, so a database leak can't be used to take over accounts.
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
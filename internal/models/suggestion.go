@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SuggestionDismissal stops a user from being suggested to someone again.
+type SuggestionDismissal struct {
+	UserID      uint      `json:"user_id" gorm:"primaryKey"`
+	DismissedID uint      `json:"dismissed_id" gorm:"primaryKey"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type FollowSuggestion struct {
+	UserSummary
+	Reason string `json:"reason"`
+}
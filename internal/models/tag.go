@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// MaxTags is how many tags a blog can carry.
+const MaxTags = 5
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// BlogTag files a blog under a free-form tag, on top of its genre. Tags are
+// stored normalized, see NormalizeTag.
+type BlogTag struct {
+	BlogID uint   `gorm:"primaryKey"`
+	Tag    string `gorm:"primaryKey;index"`
+}
+
+// MarshalJSON lists a blog's tags as plain strings.
+func (t BlogTag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Tag)
+}
+
+// NormalizeTag is the form tags are stored and looked up in: trimmed and
+// lower case, so "Go" and "go " are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// IsValidTag reports whether a normalized tag is 1-30 letters and digits,
+// optionally joined by single hyphens.
+func IsValidTag(tag string) bool {
+	return len(tag) <= 30 && tagPattern.MatchString(tag)
+}
+
+// NormalizeTags normalizes tags and drops duplicates, keeping the order
+// they were given in.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsValidTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want bool
+	}{
+		{"go", true},
+		{"web-dev", true},
+		{"2026", true},
+		{"abcdefghijklmnopqrstuvwxyz0123", true},
+		{"abcdefghijklmnopqrstuvwxyz01234", false},
+		{"", false},
+		{"Go", false},
+		{"web--dev", false},
+		{"-go", false},
+		{"go-", false},
+		{"web dev", false},
+		{"c++", false},
+		{"café", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := IsValidTag(tt.tag); got != tt.want {
+				t.Errorf("IsValidTag(%q) = %v, want %v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{" Go", "postgres", "go", "GO ", "web-dev"})
+	want := []string{"go", "postgres", "web-dev"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NormalizeTags = %v, want %v", got, want)
+	}
+}
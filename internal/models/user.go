@@ -7,29 +7,111 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Email     string         `json:"email" gorm:"unique;not null;index"`
-	Name      string         `json:"name" gorm:"not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	Blogs     []Blog         `json:"blogs,omitempty" gorm:"foreignKey:AuthorID"`
-	Comments  []Comment      `json:"comments,omitempty" gorm:"foreignKey:AuthorID"`
-	Following []Follows      `json:"following,omitempty" gorm:"foreignKey:FollowerID"`
-	Followers []Follows      `json:"followers,omitempty" gorm:"foreignKey:FollowingID"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
-}
-
-type UserResponse struct {
 	ID    uint   `json:"id" gorm:"primaryKey"`
 	Email string `json:"email" gorm:"unique;not null;index"`
 	Name  string `json:"name" gorm:"not null"`
+	// Handle is the unique @name used in mentions and search. Accounts
+	// created before handles existed don't have one yet.
+	Handle   *string `json:"handle,omitempty" gorm:"uniqueIndex"`
+	Password string  `json:"-" gorm:"not null"`
+	// EmailVerified gates publishing and commenting until the user proves
+	// they own the address.
+	EmailVerified   bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// TokenVersion is embedded in every JWT; bumping it signs the user out
+	// everywhere.
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+	// TOTPSecret is set during enrollment but only enforced once
+	// TOTPEnabled is true.
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"-" gorm:"not null;default:false"`
+	TOTPLastStep int64  `json:"-" gorm:"not null;default:0"`
+	// IsPrivate limits the user's posts to approved followers and turns
+	// follows into requests.
+	IsPrivate bool `json:"is_private" gorm:"not null;default:false"`
+	// IsAdmin is granted directly in the database. Like TOTPEnabled it is
+	// only shown to the user themselves, see AccountResponse.
+	IsAdmin bool `json:"-" gorm:"not null;default:false"`
+	// DigestFrequency is how often the user gets an email digest of new
+	// posts; DigestSentAt is when the last one went out. Only the user sees
+	// it, see AccountResponse.
+	DigestFrequency string     `json:"-" gorm:"not null;default:weekly"`
+	DigestSentAt    *time.Time `json:"-"`
+	// DeletionScheduledAt is set while an account deletion is in its grace
+	// period; DeletionBlogAction says what happens to the user's blogs then.
+	// Only the user sees it, see AccountResponse.
+	DeletionScheduledAt *time.Time     `json:"-" gorm:"index"`
+	DeletionBlogAction  string         `json:"-"`
+	Blogs               []Blog         `json:"blogs,omitempty" gorm:"foreignKey:AuthorID"`
+	Comments            []Comment      `json:"comments,omitempty" gorm:"foreignKey:AuthorID"`
+	Following           []Follows      `json:"following,omitempty" gorm:"foreignKey:FollowerID"`
+	Followers           []Follows      `json:"followers,omitempty" gorm:"foreignKey:FollowingID"`
+	Identities          []UserIdentity `json:"identities,omitempty" gorm:"foreignKey:UserID"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
+	DeletedAt           gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Digest frequencies.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+type UserResponse struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Email  string `json:"email" gorm:"unique;not null;index"`
+	Name   string `json:"name" gorm:"not null"`
+	Handle string `json:"handle,omitempty"`
 }
 
 func (u *User) ToResponse() UserResponse {
-	return UserResponse{
+	response := UserResponse{
 		ID:    u.ID,
 		Email: u.Email,
 		Name:  u.Name,
 	}
+	if u.Handle != nil {
+		response.Handle = *u.Handle
+	}
+	return response
+}
+
+// AccountResponse is the signed-in user's view of their own account,
+// including the security settings nobody else may see.
+type AccountResponse struct {
+	*User
+	TwoFactorEnabled    bool       `json:"two_factor_enabled"`
+	IsAdmin             bool       `json:"is_admin"`
+	DigestFrequency     string     `json:"digest_frequency"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+func (u *User) ToAccountResponse() AccountResponse {
+	return AccountResponse{
+		User:                u,
+		TwoFactorEnabled:    u.TOTPEnabled,
+		IsAdmin:             u.IsAdmin,
+		DigestFrequency:     u.DigestFrequency,
+		DeletionScheduledAt: u.DeletionScheduledAt,
+	}
+}
+
+// UserSummary is how other people appear in search results and directories.
+type UserSummary struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Handle    string `json:"handle,omitempty"`
+	IsPrivate bool   `json:"is_private"`
+	Followers int64  `json:"followers"`
+}
+
+// AuthorSummary is a UserSummary with publishing stats for the author
+// directory.
+type AuthorSummary struct {
+	UserSummary
+	Posts           int64     `json:"posts"`
+	Votes           int64     `json:"votes"`
+	LastPublishedAt time.Time `json:"last_published_at"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestAccountOnlyFields checks that settings meant for the account owner
+// stay out of the public user JSON.
+func TestAccountOnlyFields(t *testing.T) {
+	due := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	u := &User{
+		ID:                  1,
+		Email:               "ann@example.com",
+		Name:                "Ann",
+		TOTPEnabled:         true,
+		IsAdmin:             true,
+		DigestFrequency:     DigestDaily,
+		DeletionScheduledAt: &due,
+	}
+	private := []string{"two_factor_enabled", "is_admin", "digest_frequency", "deletion_scheduled_at"}
+
+	decode := func(v interface{}) map[string]interface{} {
+		body, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			t.Fatal(err)
+		}
+		return fields
+	}
+
+	public := decode(u)
+	for _, key := range private {
+		if _, ok := public[key]; ok {
+			t.Errorf("public user JSON has %q", key)
+		}
+	}
+	account := decode(u.ToAccountResponse())
+	for _, key := range private {
+		if _, ok := account[key]; !ok {
+			t.Errorf("account JSON is missing %q", key)
+		}
+	}
+}
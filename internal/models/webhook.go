@@ -0,0 +1,100 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Events a webhook can subscribe to.
+const (
+	WebhookBlogPublished  = "blog.published"
+	WebhookBlogUpdated    = "blog.updated"
+	WebhookBlogDeleted    = "blog.deleted"
+	WebhookCommentCreated = "comment.created"
+	WebhookVoteToggled    = "vote.toggled"
+	WebhookUserFollowed   = "user.followed"
+)
+
+var WebhookEvents = []string{
+	WebhookBlogPublished,
+	WebhookBlogUpdated,
+	WebhookBlogDeleted,
+	WebhookCommentCreated,
+	WebhookVoteToggled,
+	WebhookUserFollowed,
+}
+
+func IsValidWebhookEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook delivers events about its owner's blogs and followers to URL.
+// Global webhooks can only be registered by admins and get every event on
+// the platform. Secret signs each delivery and is only shown on creation.
+type Webhook struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	UserID    uint           `json:"-" gorm:"not null;index"`
+	URL       string         `json:"url" gorm:"not null"`
+	Secret    string         `json:"-" gorm:"not null"`
+	Events    string         `json:"-" gorm:"not null"`
+	Global    bool           `json:"global" gorm:"not null;default:false"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (w *Webhook) EventList() []string {
+	return strings.Fields(w.Events)
+}
+
+type WebhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Global    bool      `json:"global"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w *Webhook) ToResponse() WebhookResponse {
+	return WebhookResponse{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.EventList(),
+		Global:    w.Global,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+// Delivery states.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event sent, or still to be sent, to a webhook.
+// Redelivering creates a new row with the same EventID so receivers can
+// drop duplicates.
+type WebhookDelivery struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	WebhookID      uint       `json:"webhook_id" gorm:"not null;index"`
+	EventID        string     `json:"event_id" gorm:"not null;index"`
+	Event          string     `json:"event" gorm:"not null"`
+	Payload        string     `json:"payload" gorm:"type:text;not null"`
+	Status         string     `json:"status" gorm:"not null;index"`
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty" gorm:"index"`
+	ResponseStatus int        `json:"response_status,omitempty"`
+	ResponseBody   string     `json:"response_body,omitempty" gorm:"type:text"`
+	Error          string     `json:"error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,269 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// channel is the Postgres NOTIFY channel every replica listens on.
+const channel = "boldnarratives_events"
+
+// NOTIFY payloads must stay under 8000 bytes; bigger events are sent
+// without their data and clients refetch.
+const maxPayload = 7900
+
+// events queued for a client that isn't reading are dropped past this
+const subscriberBuffer = 32
+
+// Event types.
+const (
+	EventNotification   = "notification"
+	EventCommentCreated = "comment.created"
+	EventCommentDeleted = "comment.deleted"
+	EventVoteUpdated    = "vote.updated"
+	EventTyping         = "typing"
+	EventReaders        = "readers"
+
+	// tells the brokers to revoke subscriptions; never sent to clients
+	eventAccessChanged = "access.changed"
+)
+
+// Event is delivered to every subscriber of UserID, or of BlogID when
+// UserID is zero. ActorID lets subscribers skip events caused by people
+// they can't see.
+type Event struct {
+	Type    string          `json:"type"`
+	UserID  uint            `json:"user_id,omitempty"`
+	BlogID  uint            `json:"blog_id,omitempty"`
+	ActorID uint            `json:"actor_id,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Access names the subscriptions to revoke: those of UserIDs, those
+// watching a blog by AuthorID and those watching BlogID.
+type Access struct {
+	UserIDs  []uint `json:"user_ids,omitempty"`
+	AuthorID uint   `json:"author_id,omitempty"`
+	BlogID   uint   `json:"blog_id,omitempty"`
+}
+
+// Subscription delivers events on C until it is revoked, which closes
+// Revoked. The client should then check access again and subscribe anew.
+type Subscription struct {
+	C        <-chan Event
+	Revoked  <-chan struct{}
+	c        chan Event
+	revoked  chan struct{}
+	userId   uint
+	blogId   uint
+	authorId uint
+	hidden   map[uint]bool
+}
+
+// Broker fans events out to the clients connected to this replica. Events
+// are published through Postgres NOTIFY and come back to every replica,
+// this one included, through Run.
+type Broker struct {
+	db   *gorm.DB
+	dsn  string
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func NewBroker(db *gorm.DB, dsn string) *Broker {
+	return &Broker{
+		db:   db,
+		dsn:  dsn,
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a client of userId, optionally watching blogId. The
+// people the user blocked, was blocked by or muted are looked up once here;
+// Revoke ends the subscription when that or the user's access to the blog
+// may have changed.
+func (b *Broker) Subscribe(userId, blogId uint) (*Subscription, error) {
+	var hidden []uint
+	if err := block.Hidden(b.db, userId).Scan(&hidden).Error; err != nil {
+		return nil, err
+	}
+	var authorIds []uint
+	if blogId != 0 {
+		if err := b.db.Model(&models.Blog{}).Where("id=?", blogId).Pluck("author_id", &authorIds).Error; err != nil {
+			return nil, err
+		}
+	}
+	c := make(chan Event, subscriberBuffer)
+	revoked := make(chan struct{})
+	sub := &Subscription{
+		C:       c,
+		Revoked: revoked,
+		c:       c,
+		revoked: revoked,
+		userId:  userId,
+		blogId:  blogId,
+		hidden:  make(map[uint]bool, len(hidden)),
+	}
+	if len(authorIds) > 0 {
+		sub.authorId = authorIds[0]
+	}
+	for _, id := range hidden {
+		sub.hidden[id] = true
+	}
+
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub, nil
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	delete(b.subs, sub)
+	b.mu.Unlock()
+}
+
+// Publish sends an event to every replica. It is best effort: failures are
+// logged and the caller carries on.
+func (b *Broker) Publish(e Event, data interface{}) {
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			log.Printf("failed to encode %s event: %v", e.Type, err)
+			return
+		}
+		e.Data = raw
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("failed to encode %s event: %v", e.Type, err)
+		return
+	}
+	if len(payload) > maxPayload {
+		e.Data = nil
+		payload, _ = json.Marshal(e)
+	}
+	if err := b.db.Exec("SELECT pg_notify(?, ?)", channel, string(payload)).Error; err != nil {
+		log.Printf("failed to publish %s event: %v", e.Type, err)
+	}
+}
+
+// Revoke ends the matching subscriptions on every replica. It is best
+// effort like Publish.
+func (b *Broker) Revoke(a Access) {
+	b.Publish(Event{Type: eventAccessChanged}, a)
+}
+
+func (b *Broker) revoke(a Access) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subs {
+		if !sub.affectedBy(a) {
+			continue
+		}
+		delete(b.subs, sub)
+		close(sub.revoked)
+	}
+}
+
+func (b *Broker) dispatch(e Event) {
+	if e.Type == eventAccessChanged {
+		var a Access
+		if err := json.Unmarshal(e.Data, &a); err != nil {
+			log.Printf("ignoring malformed access change: %v", err)
+			return
+		}
+		b.revoke(a)
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if !sub.wants(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+		}
+	}
+}
+
+func (s *Subscription) wants(e Event) bool {
+	if e.ActorID != 0 && s.hidden[e.ActorID] {
+		return false
+	}
+	if e.UserID != 0 {
+		return e.UserID == s.userId
+	}
+	return e.BlogID != 0 && e.BlogID == s.blogId
+}
+
+func (s *Subscription) affectedBy(a Access) bool {
+	for _, id := range a.UserIDs {
+		if id == s.userId {
+			return true
+		}
+	}
+	if s.blogId == 0 {
+		return false
+	}
+	return (a.AuthorID != 0 && a.AuthorID == s.authorId) || (a.BlogID != 0 && a.BlogID == s.blogId)
+}
+
+// Run listens for events from every replica until ctx is done, reconnecting
+// with backoff when the connection drops.
+func (b *Broker) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		connected, err := b.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("realtime listener stopped, reconnecting in %s: %v", backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listen reports whether it got as far as listening before failing.
+func (b *Broker) listen(ctx context.Context) (bool, error) {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+channel); err != nil {
+		return false, err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			log.Printf("ignoring malformed realtime event: %v", err)
+			continue
+		}
+		b.dispatch(e)
+	}
+}
@@ -0,0 +1,63 @@
+package realtime
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDispatchAccessChanged(t *testing.T) {
+	// user 1 reads blog 10 by author 5, user 2 only has a notification stream
+	newSubs := func(b *Broker) (reader, streamer *Subscription) {
+		reader = &Subscription{revoked: make(chan struct{}), userId: 1, blogId: 10, authorId: 5}
+		streamer = &Subscription{revoked: make(chan struct{}), userId: 2}
+		b.subs[reader] = struct{}{}
+		b.subs[streamer] = struct{}{}
+		return reader, streamer
+	}
+
+	tests := []struct {
+		name            string
+		access          Access
+		revokesReader   bool
+		revokesStreamer bool
+	}{
+		{name: "block involving the reader", access: Access{UserIDs: []uint{1, 3}}, revokesReader: true},
+		{name: "mute by the streamer", access: Access{UserIDs: []uint{2}}, revokesStreamer: true},
+		{name: "author went private", access: Access{AuthorID: 5}, revokesReader: true},
+		{name: "another author went private", access: Access{AuthorID: 6}},
+		{name: "blog deleted", access: Access{BlogID: 10}, revokesReader: true},
+		// streams without a blog have no author to match
+		{name: "no author", access: Access{AuthorID: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBroker(nil, "")
+			reader, streamer := newSubs(b)
+			data, err := json.Marshal(tt.access)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.dispatch(Event{Type: eventAccessChanged, Data: data})
+
+			for _, c := range []struct {
+				sub  *Subscription
+				want bool
+			}{{reader, tt.revokesReader}, {streamer, tt.revokesStreamer}} {
+				_, subscribed := b.subs[c.sub]
+				if subscribed == c.want {
+					t.Errorf("user %d: subscribed = %v, want revoked = %v", c.sub.userId, subscribed, c.want)
+				}
+				select {
+				case <-c.sub.revoked:
+					if !c.want {
+						t.Errorf("user %d: revoked unexpectedly", c.sub.userId)
+					}
+				default:
+					if c.want {
+						t.Errorf("user %d: Revoked was not closed", c.sub.userId)
+					}
+				}
+			}
+		})
+	}
+}
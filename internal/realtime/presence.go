@@ -0,0 +1,70 @@
+package realtime
+
+import (
+	"log"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+)
+
+// PresenceInterval is how often live connections must call Touch. Readers
+// not seen for three intervals are no longer counted.
+const PresenceInterval = 30 * time.Second
+
+const presenceTTL = 3 * PresenceInterval
+
+// Join records a reader of blogId and tells the room the new reader count.
+// It returns the connection id to pass to Touch and Leave.
+func (b *Broker) Join(blogId, userId uint) (string, error) {
+	connectionId, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	reader := &models.LiveReader{
+		ConnectionID: connectionId,
+		BlogID:       blogId,
+		UserID:       userId,
+		SeenAt:       time.Now(),
+	}
+	if err := b.db.Create(reader).Error; err != nil {
+		return "", err
+	}
+	b.publishReaders(blogId)
+	return connectionId, nil
+}
+
+func (b *Broker) Touch(connectionId string) error {
+	return b.db.Model(&models.LiveReader{}).
+		Where("connection_id=?", connectionId).
+		Update("seen_at", time.Now()).Error
+}
+
+func (b *Broker) Leave(connectionId string, blogId uint) {
+	if err := b.db.Where("connection_id=?", connectionId).Delete(&models.LiveReader{}).Error; err != nil {
+		log.Printf("failed to remove live reader: %v", err)
+	}
+	b.publishReaders(blogId)
+}
+
+// Readers counts the distinct users reading blogId live, across replicas.
+func (b *Broker) Readers(blogId uint) (int64, error) {
+	var count int64
+	err := b.db.Model(&models.LiveReader{}).
+		Where("blog_id=? AND seen_at > ?", blogId, time.Now().Add(-presenceTTL)).
+		Distinct("user_id").
+		Count(&count).Error
+	return count, err
+}
+
+func (b *Broker) publishReaders(blogId uint) {
+	// readers left behind by crashed replicas
+	b.db.Where("seen_at < ?", time.Now().Add(-presenceTTL)).Delete(&models.LiveReader{})
+
+	count, err := b.Readers(blogId)
+	if err != nil {
+		log.Printf("failed to count live readers of blog %d: %v", blogId, err)
+		return
+	}
+	b.Publish(Event{Type: EventReaders, BlogID: blogId}, map[string]interface{}{"readers": count})
+}
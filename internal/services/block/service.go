@@ -0,0 +1,135 @@
+package block
+
+import (
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSelf        = errors.New("you can't block or mute yourself")
+	ErrUserMissing = errors.New("user not found")
+)
+
+type Service struct {
+	db         *gorm.DB
+	dispatcher *events.Dispatcher
+}
+
+func NewService(db *gorm.DB, dispatcher *events.Dispatcher) *Service {
+	return &Service{db: db, dispatcher: dispatcher}
+}
+
+// Block also removes any follow or follow request in either direction.
+func (s *Service) Block(blockerId, blockedId uint) error {
+	if blockerId == blockedId {
+		return ErrSelf
+	}
+	if err := s.requireUser(blockedId); err != nil {
+		return err
+	}
+	return s.changeAccess([]uint{blockerId, blockedId}, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Block{BlockerID: blockerId, BlockedID: blockedId}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().
+			Where("(follower_id=? AND following_id=?) OR (follower_id=? AND following_id=?)", blockerId, blockedId, blockedId, blockerId).
+			Delete(&models.Follows{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("(requester_id=? AND target_id=?) OR (requester_id=? AND target_id=?)", blockerId, blockedId, blockedId, blockerId).
+			Delete(&models.FollowRequest{}).Error
+	})
+}
+
+func (s *Service) Unblock(blockerId, blockedId uint) error {
+	return s.changeAccess([]uint{blockerId, blockedId}, func(tx *gorm.DB) error {
+		return tx.Where("blocker_id=? AND blocked_id=?", blockerId, blockedId).Delete(&models.Block{}).Error
+	})
+}
+
+func (s *Service) Mute(muterId, mutedId uint) error {
+	if muterId == mutedId {
+		return ErrSelf
+	}
+	if err := s.requireUser(mutedId); err != nil {
+		return err
+	}
+	return s.changeAccess([]uint{muterId}, func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.Mute{MuterID: muterId, MutedID: mutedId}).Error
+	})
+}
+
+func (s *Service) Unmute(muterId, mutedId uint) error {
+	return s.changeAccess([]uint{muterId}, func(tx *gorm.DB) error {
+		return tx.Where("muter_id=? AND muted_id=?", muterId, mutedId).Delete(&models.Mute{}).Error
+	})
+}
+
+// changeAccess runs change and tells live connections of userIds that what
+// they may see has changed.
+func (s *Service) changeAccess(userIds []uint, change func(tx *gorm.DB) error) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := change(tx); err != nil {
+			return err
+		}
+		return events.Emit(tx, events.AccessChanged{UserIDs: userIds})
+	})
+	if err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+func (s *Service) ListBlocked(userId uint) ([]models.RestrictedUserResponse, error) {
+	var blocks []models.Block
+	err := s.db.Where("blocker_id=?", userId).Preload("Blocked").Order("created_at DESC").Find(&blocks).Error
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.RestrictedUserResponse, 0, len(blocks))
+	for _, b := range blocks {
+		response = append(response, models.RestrictedUserResponse{
+			ID:        b.BlockedID,
+			Name:      b.Blocked.Name,
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+func (s *Service) ListMuted(userId uint) ([]models.RestrictedUserResponse, error) {
+	var mutes []models.Mute
+	err := s.db.Where("muter_id=?", userId).Preload("Muted").Order("created_at DESC").Find(&mutes).Error
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.RestrictedUserResponse, 0, len(mutes))
+	for _, m := range mutes {
+		response = append(response, models.RestrictedUserResponse{
+			ID:        m.MutedID,
+			Name:      m.Muted.Name,
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+func (s *Service) requireUser(userId uint) error {
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("id=?", userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrUserMissing
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package block
+
+import (
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Between reports whether either user has blocked the other. Other services
+// call it before letting one user act on the other's content.
+func Between(db *gorm.DB, a, b uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Block{}).
+		Where("(blocker_id=? AND blocked_id=?) OR (blocker_id=? AND blocked_id=?)", a, b, b, a).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Visible is a query scope that drops rows whose column refers to a user the
+// viewer has blocked, been blocked by, or muted. A zero viewer sees
+// everything.
+func Visible(viewerId uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerId == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN (?)", Hidden(db, viewerId))
+	}
+}
+
+// NotBlocked is like Visible but ignores mutes, for places where the viewer
+// still needs to see people they muted, like their own follower list.
+func NotBlocked(viewerId uint, column string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerId == 0 {
+			return db
+		}
+		return db.Where(column+" NOT IN (?)", blockedUsers(db, viewerId))
+	}
+}
+
+func blockedUsers(db *gorm.DB, viewerId uint) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Raw(
+		"SELECT blocked_id FROM blocks WHERE blocker_id = ? UNION SELECT blocker_id FROM blocks WHERE blocked_id = ?",
+		viewerId, viewerId)
+}
+
+// Hidden is a subquery of the IDs of everyone viewerId blocked, was blocked
+// by or muted, for queries too involved for the Visible scope.
+func Hidden(db *gorm.DB, viewerId uint) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).Raw(
+		"SELECT blocked_id FROM blocks WHERE blocker_id = ? UNION SELECT blocker_id FROM blocks WHERE blocked_id = ? UNION SELECT muted_id FROM mutes WHERE muter_id = ?",
+		viewerId, viewerId, viewerId)
+}
@@ -0,0 +1,61 @@
+package blog
+
+import (
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+// Author directory orderings.
+const (
+	AuthorsByFollowers = "followers"
+	AuthorsByVotes     = "votes"
+	AuthorsByRecent    = "recent"
+)
+
+var authorOrders = map[string]string{
+	AuthorsByFollowers: "followers DESC, posts DESC, users.id",
+	AuthorsByVotes:     "votes DESC, followers DESC, users.id",
+	AuthorsByRecent:    "last_published_at DESC, users.id",
+}
+
+type AuthorFilter struct {
+	ViewerID uint
+	Genre    string
+	Sort     string
+	Skip     int
+	Limit    int
+}
+
+// GetAuthors lists everyone with at least one blog the viewer can see.
+// With a genre only posts in that genre count towards posts and activity.
+func (s *Service) GetAuthors(opts AuthorFilter) ([]models.AuthorSummary, error) {
+	order, ok := authorOrders[opts.Sort]
+	if !ok {
+		order = authorOrders[AuthorsByFollowers]
+	}
+
+	query := s.db.Model(&models.Blog{}).
+		Select(`users.id, users.name, COALESCE(users.handle, '') AS handle, users.is_private,
+			COUNT(blogs.id) AS posts,
+			MAX(blogs.created_at) AS last_published_at,
+			(SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id AND follows.deleted_at IS NULL) AS followers,
+			(SELECT COUNT(*) FROM votes JOIN blogs vb ON vb.id = votes.blog_id
+				WHERE vb.author_id = users.id AND vb.deleted_at IS NULL AND votes.deleted_at IS NULL) AS votes`).
+		Joins("JOIN users ON users.id = blogs.author_id AND users.deleted_at IS NULL").
+		Scopes(VisibleTo(opts.ViewerID))
+	if opts.Genre != "" && opts.Genre != "All" {
+		query = query.Where("blogs.genre=?", opts.Genre)
+	}
+	query = query.Group("users.id").Order(order)
+	if opts.Limit > 0 {
+		query = query.Limit(opts.Limit)
+	}
+	if opts.Skip > 0 {
+		query = query.Offset(opts.Skip)
+	}
+
+	var authors []models.AuthorSummary
+	if err := query.Scan(&authors).Error; err != nil {
+		return nil, err
+	}
+	return authors, nil
+}
@@ -0,0 +1,41 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"gorm.io/gorm"
+)
+
+// subscribeCounters keeps the vote and comment counts stored on blogs.
+// Counts are recounted rather than stepped, so a repeat after a retry, or
+// events handled out of order, still leave them right.
+func (s *Service) subscribeCounters(d *events.Dispatcher) {
+	events.On(d, "counters.vote_toggled", func(ctx context.Context, e events.VoteToggled) error {
+		return RecountVotes(s.db, e.BlogID)
+	})
+	events.On(d, "counters.comment_created", func(ctx context.Context, e events.CommentCreated) error {
+		return recountComments(s.db, e.BlogID)
+	})
+	events.On(d, "counters.comment_deleted", func(ctx context.Context, e events.CommentDeleted) error {
+		return recountComments(s.db, e.BlogID)
+	})
+}
+
+// RecountVotes stores the number of live votes on each of blogIds. It is
+// for changes that remove votes without a VoteToggled event, like erasing
+// an account.
+func RecountVotes(db *gorm.DB, blogIds ...uint) error {
+	if len(blogIds) == 0 {
+		return nil
+	}
+	return db.Exec(`UPDATE blogs SET vote_count =
+		(SELECT COUNT(*) FROM votes WHERE votes.blog_id = blogs.id AND votes.deleted_at IS NULL)
+		WHERE id IN ?`, blogIds).Error
+}
+
+func recountComments(db *gorm.DB, blogId uint) error {
+	return db.Exec(`UPDATE blogs SET comment_count =
+		(SELECT COUNT(*) FROM comments WHERE comments.blog_id = blogs.id AND comments.deleted_at IS NULL)
+		WHERE id = ?`, blogId).Error
+}
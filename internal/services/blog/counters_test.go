@@ -0,0 +1,62 @@
+package blog
+
+import (
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+func TestRecount(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.Blog{}, &models.BlogTag{}, &models.Comment{}, &models.Vote{})
+
+	var users []*models.User
+	for _, email := range []string{"ann@example.com", "bob@example.com", "cat@example.com"} {
+		u := &models.User{Email: email, Name: email, Password: "x"}
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, u)
+	}
+	// counts are never written with the blog, only recounted
+	b := &models.Blog{Title: "t", Content: "c", Genre: "Technology", AuthorID: users[0].ID, VoteCount: 9}
+	if err := db.Create(b).Error; err != nil {
+		t.Fatal(err)
+	}
+	b.CommentCount = 9
+	if err := db.Save(b).Error; err != nil {
+		t.Fatal(err)
+	}
+	var got models.Blog
+	if err := db.First(&got, b.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.VoteCount != 0 || got.CommentCount != 0 {
+		t.Fatalf("saving the blog wrote counts %d and %d", got.VoteCount, got.CommentCount)
+	}
+	for _, u := range users {
+		if err := db.Create(&models.Vote{UserID: u.ID, BlogID: b.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&models.Comment{Comment: "hi", AuthorID: u.ID, BlogID: b.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// deleted votes and comments don't count
+	db.Where("user_id=?", users[2].ID).Delete(&models.Vote{})
+	db.Where("author_id=?", users[2].ID).Delete(&models.Comment{})
+
+	if err := RecountVotes(db, b.ID); err != nil {
+		t.Fatalf("RecountVotes: %v", err)
+	}
+	if err := recountComments(db, b.ID); err != nil {
+		t.Fatalf("recountComments: %v", err)
+	}
+
+	if err := db.First(&got, b.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.VoteCount != 2 || got.CommentCount != 2 {
+		t.Errorf("counts = %d votes, %d comments, want 2 and 2", got.VoteCount, got.CommentCount)
+	}
+}
@@ -0,0 +1,34 @@
+package blog
+
+import (
+	"context"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+// subscribeSearch indexes blogs for full-text search when they are
+// published or edited. Indexing rebuilds the blog's vector from what is
+// stored, so a repeat is harmless.
+func (s *Service) subscribeSearch(d *events.Dispatcher) {
+	events.On(d, "search.blog_published", func(ctx context.Context, e events.BlogPublished) error {
+		return reindex(s.db, e.BlogID)
+	})
+	events.On(d, "search.blog_updated", func(ctx context.Context, e events.BlogUpdated) error {
+		return reindex(s.db, e.BlogID)
+	})
+}
+
+func reindex(db *gorm.DB, blogId uint) error {
+	return db.Exec("UPDATE blogs SET search_vector = "+models.BlogSearchDocument+" WHERE id = ?", blogId).Error
+}
+
+// matching keeps blogs whose title contains search, or whose title, tags
+// or content match it as a web search query. Blogs not indexed yet are
+// still found by title.
+func matching(search string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(blogs.title ILIKE ? OR blogs.search_vector @@ websearch_to_tsquery('simple', ?))", "%"+search+"%", search)
+	}
+}
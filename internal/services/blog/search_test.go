@@ -0,0 +1,73 @@
+package blog
+
+import (
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+func TestSearch(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.Blog{}, &models.BlogTag{}, &models.Comment{}, &models.Vote{}, &models.Follows{})
+	s := NewService(db, nil, nil)
+
+	ann := &models.User{Email: "ann@example.com", Name: "Ann", Password: "x"}
+	if err := db.Create(ann).Error; err != nil {
+		t.Fatal(err)
+	}
+	newBlog := func(title, content string, tags ...string) *models.Blog {
+		b := &models.Blog{Title: title, Content: content, Genre: "Technology", AuthorID: ann.ID}
+		if err := db.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := setTags(db, b.ID, tags); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	indexed := newBlog("Notes", "Tuning autovacuum on a busy table", "postgres")
+	if err := reindex(db, indexed.ID); err != nil {
+		t.Fatalf("reindex: %v", err)
+	}
+	// not indexed yet, so only its title can match
+	pending := newBlog("Postgres at work", "nothing about vacuum")
+
+	tests := []struct {
+		search string
+		want   []uint
+	}{
+		{search: "autovacuum", want: []uint{indexed.ID}},
+		{search: "postgres", want: []uint{pending.ID, indexed.ID}},
+		{search: "busy table", want: []uint{indexed.ID}},
+		{search: "busy -table", want: nil},
+		{search: "gres at", want: []uint{pending.ID}},
+		{search: "kubernetes", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.search, func(t *testing.T) {
+			blogs, err := s.GetBlogsSortedByTime(Filter{Search: tt.search}, false)
+			if err != nil {
+				t.Fatalf("GetBlogsSortedByTime: %v", err)
+			}
+			var got []uint
+			for _, b := range blogs {
+				got = append(got, b.ID)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+			count, err := s.GetBlogsCount(Filter{Search: tt.search})
+			if err != nil {
+				t.Fatalf("GetBlogsCount: %v", err)
+			}
+			if count != int64(len(tt.want)) {
+				t.Errorf("count = %d, want %d", count, len(tt.want))
+			}
+		})
+	}
+}
@@ -5,53 +5,87 @@ import (
 	"sort"
 	"time"
 
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
 	"gorm.io/gorm"
 )
 
+// ErrBlocked is returned when the author of a blog and the user acting on it
+// have blocked one another.
+var ErrBlocked = errors.New("you can't interact with this blog")
+
+// ErrInvalidParent is returned when a reply points at a comment on another
+// blog.
+var ErrInvalidParent = errors.New("parent comment not found on this blog")
+
+// Service writes blogs, comments and votes together with the domain events
+// they cause; everything that reacts to them is an outbox subscriber.
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	broker     *realtime.Broker
+	dispatcher *events.Dispatcher
 }
 
 type Filter struct {
+	// ViewerID hides blogs the viewer may not read, see VisibleTo. Zero
+	// means an anonymous viewer.
+	ViewerID uint
 	Genre    string
+	Tag      string
 	AuthorID *uint
 	Search   string
 	Skip     int
 	Limit    int
 }
 
-func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+func NewService(db *gorm.DB, broker *realtime.Broker, dispatcher *events.Dispatcher) *Service {
+	return &Service{db: db, broker: broker, dispatcher: dispatcher}
 }
 
-func (s *Service) CreateBlog(authorId uint, title, content, genre string) (*models.Blog, error) {
+func (s *Service) CreateBlog(authorId uint, title, content, genre string, tags []string) (*models.Blog, error) {
 	blog := &models.Blog{
 		AuthorID: authorId,
 		Title:    title,
 		Content:  content,
 		Genre:    genre,
 	}
-	if err := s.db.Create(blog).Error; err != nil {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(blog).Error; err != nil {
+			return err
+		}
+		if err := setTags(tx, blog.ID, tags); err != nil {
+			return err
+		}
+		return events.Emit(tx, events.BlogPublished{BlogID: blog.ID, AuthorID: authorId})
+	})
+	if err != nil {
 		return nil, err
 	}
-	s.db.Preload("Author").First(&blog)
+	s.dispatcher.Wake()
+	s.db.Preload("Author").Preload("Tags").First(&blog)
 
 	return blog, nil
 }
 
-func (s *Service) GetBlogById(blogId uint) (*models.Blog, error) {
+func (s *Service) GetBlogById(blogId, viewerId uint) (*models.Blog, error) {
 	var blog models.Blog
-	err := s.db.Preload("Author").Preload("Comments", func(db *gorm.DB) *gorm.DB {
-		return db.Order("created_at DESC").Preload("Author")
+	err := s.db.Preload("Author").Preload("Tags").Preload("Comments", func(db *gorm.DB) *gorm.DB {
+		return db.Scopes(block.Visible(viewerId, "author_id")).Order("created_at DESC").Preload("Author")
 	}).First(&blog, blogId).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := s.checkAccess(&blog, viewerId); err != nil {
+		return nil, err
+	}
 	return &blog, nil
 }
 
-func (s *Service) UpdateBlog(blogId uint, title, content, genre string, userId uint) (*models.Blog, error) {
+// UpdateBlog replaces the blog's title, content and genre, and its tags
+// unless tags is nil.
+func (s *Service) UpdateBlog(blogId uint, title, content, genre string, tags []string, userId uint) (*models.Blog, error) {
 	var blog models.Blog
 	err := s.db.First(&blog, blogId).Error
 	if err != nil {
@@ -63,12 +97,48 @@ func (s *Service) UpdateBlog(blogId uint, title, content, genre string, userId u
 	blog.Title = title
 	blog.Content = content
 	blog.Genre = genre
-	if err := s.db.Save(&blog).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&blog).Error; err != nil {
+			return err
+		}
+		if tags != nil {
+			if err := setTags(tx, blog.ID, tags); err != nil {
+				return err
+			}
+		}
+		return events.Emit(tx, events.BlogUpdated{BlogID: blog.ID, AuthorID: blog.AuthorID})
+	})
+	if err != nil {
 		return nil, err
 	}
+	s.dispatcher.Wake()
+	s.db.Where("blog_id=?", blog.ID).Find(&blog.Tags)
 	return &blog, nil
 }
 
+// setTags replaces the tags of blogId.
+func setTags(tx *gorm.DB, blogId uint, tags []string) error {
+	if err := tx.Where("blog_id=?", blogId).Delete(&models.BlogTag{}).Error; err != nil {
+		return err
+	}
+	tags = models.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]models.BlogTag, 0, len(tags))
+	for _, tag := range tags {
+		rows = append(rows, models.BlogTag{BlogID: blogId, Tag: tag})
+	}
+	return tx.Create(&rows).Error
+}
+
+// taggedWith keeps blogs carrying tag.
+func taggedWith(tag string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("EXISTS (SELECT 1 FROM blog_tags WHERE blog_tags.blog_id = blogs.id AND blog_tags.tag = ?)", models.NormalizeTag(tag))
+	}
+}
+
 func (s *Service) DeleteBlog(blogId uint, userId uint) error {
 	var blog models.Blog
 	err := s.db.First(&blog, blogId).Error
@@ -78,31 +148,46 @@ func (s *Service) DeleteBlog(blogId uint, userId uint) error {
 	if blog.AuthorID != userId {
 		return errors.New("Unauthorized")
 	}
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Where("blog_id=?", blogId).Delete(&models.Comment{}).Error; err != nil {
 			return err
 		}
 		if err := tx.Where("blog_id=?", blogId).Delete(&models.Vote{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("notification_id IN (SELECT id FROM notifications WHERE blog_id = ?)", blogId).Delete(&models.NotificationActor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blog_id=?", blogId).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
 		if err := tx.Delete(&blog).Error; err != nil {
 			return err
 		}
-		return nil
+		return events.Emit(tx, events.BlogDeleted{BlogID: blog.ID, AuthorID: blog.AuthorID, Title: blog.Title})
 	})
+	if err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
 }
 
 func (s *Service) GetBlogsCount(opts Filter) (int64, error) {
 	query := s.db.Model(&models.Blog{})
 
+	query.Scopes(VisibleTo(opts.ViewerID))
 	if opts.Genre != "" && opts.Genre != "All" {
 		query.Where("genre=?", opts.Genre)
 	}
+	if opts.Tag != "" {
+		query.Scopes(taggedWith(opts.Tag))
+	}
 	if opts.AuthorID != nil {
 		query.Where("author_id=?", *opts.AuthorID)
 	}
 	if opts.Search != "" {
-		query.Where("title ILIKE ? ", "%"+opts.Search+"%")
+		query.Scopes(matching(opts.Search))
 	}
 
 	var count int64
@@ -115,14 +200,18 @@ func (s *Service) GetBlogsCount(opts Filter) (int64, error) {
 func (s *Service) GetBlogsSortedByTime(opts Filter, ascending bool) ([]models.BlogListResponse, error) {
 	var blogs []models.Blog
 	query := s.db.Preload("Author")
+	query.Scopes(VisibleTo(opts.ViewerID))
 	if opts.Genre != "" && opts.Genre != "All" {
 		query.Where("genre=?", opts.Genre)
 	}
+	if opts.Tag != "" {
+		query.Scopes(taggedWith(opts.Tag))
+	}
 	if opts.AuthorID != nil {
 		query.Where("author_id=?", *opts.AuthorID)
 	}
 	if opts.Search != "" {
-		query.Where("title ILIKE ? ", "%"+opts.Search+"%")
+		query.Scopes(matching(opts.Search))
 	}
 	if ascending {
 		query.Order("created_at ASC")
@@ -147,14 +236,18 @@ func (s *Service) GetBlogsSortedByTime(opts Filter, ascending bool) ([]models.Bl
 func (s *Service) GetBlogsSortedByViews(opts Filter) ([]models.BlogListResponse, error) {
 	var blogs []models.Blog
 	query := s.db.Preload("Author")
+	query.Scopes(VisibleTo(opts.ViewerID))
 	if opts.Genre != "" && opts.Genre != "All" {
 		query.Where("genre=?", opts.Genre)
 	}
+	if opts.Tag != "" {
+		query.Scopes(taggedWith(opts.Tag))
+	}
 	if opts.AuthorID != nil {
 		query.Where("author_id=?", *opts.AuthorID)
 	}
 	if opts.Search != "" {
-		query.Where("title ILIKE ? ", "%"+opts.Search+"%")
+		query.Scopes(matching(opts.Search))
 	}
 	query = query.Order("views DESC,created_at DESC")
 
@@ -176,11 +269,12 @@ type TrendingBlog struct {
 	Score float64 `json:"score"`
 }
 
-func (s *Service) GetTrendingBlogs() ([]TrendingBlog, error) {
+func (s *Service) GetTrendingBlogs(viewerId uint) ([]TrendingBlog, error) {
 	var blogs []models.Blog
 
 	// Get top blogs by views
 	err := s.db.Preload("Author").
+		Scopes(VisibleTo(viewerId)).
 		Order("views DESC").
 		Limit(10).
 		Find(&blogs).Error
@@ -192,10 +286,6 @@ func (s *Service) GetTrendingBlogs() ([]TrendingBlog, error) {
 	var trendingBlogs []TrendingBlog
 
 	for _, blog := range blogs {
-		// Count votes
-		var voteCount int64
-		s.db.Model(&models.Vote{}).Where("blog_id = ?", blog.ID).Count(&voteCount)
-
 		// Calculate age in days
 		age := time.Since(blog.CreatedAt).Hours() / 24
 		if age < 1 {
@@ -203,18 +293,19 @@ func (s *Service) GetTrendingBlogs() ([]TrendingBlog, error) {
 		}
 
 		// Calculate score: (views + votes * 2) / ageInDays
-		score := (float64(blog.Views) + float64(voteCount)*2) / age
+		score := (float64(blog.Views) + float64(blog.VoteCount)*2) / age
 
 		trendingBlogs = append(trendingBlogs, TrendingBlog{
 			BlogListResponse: models.BlogListResponse{
-				ID:        blog.ID,
-				Title:     blog.Title,
-				Genre:     blog.Genre,
-				Views:     blog.Views,
-				VoteCount: voteCount,
-				AuthorID:  blog.AuthorID,
-				Author:    blog.Author.ToResponse(),
-				CreatedAt: blog.CreatedAt,
+				ID:           blog.ID,
+				Title:        blog.Title,
+				Genre:        blog.Genre,
+				Views:        blog.Views,
+				VoteCount:    blog.VoteCount,
+				CommentCount: blog.CommentCount,
+				AuthorID:     blog.AuthorID,
+				Author:       blog.Author.ToResponse(),
+				CreatedAt:    blog.CreatedAt,
 			},
 			Score: score,
 		})
@@ -240,25 +331,34 @@ func (s *Service) IncrementViews(blogId uint) error {
 }
 
 func (s *Service) ToggleVote(blogId, userId uint) (bool, error) {
-	var vote models.Vote
-	err := s.db.Where("blog_id=? and user_id=?", blogId, userId).First(&vote).Error
-	if err == nil {
-		if err := s.db.Delete(&vote).Error; err != nil {
-			return false, err
-		}
-		return false, nil
+	if _, err := s.checkInteraction(blogId, userId); err != nil {
+		return false, err
 	}
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		newVote := models.Vote{
-			BlogID: blogId,
-			UserID: userId,
-		}
-		if err := s.db.Create(&newVote).Error; err != nil {
-			return false, err
+	var voted bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var vote models.Vote
+		err := tx.Where("blog_id=? and user_id=?", blogId, userId).First(&vote).Error
+		switch {
+		case err == nil:
+			// hard delete so that voting again doesn't collide with the old row
+			if err := tx.Unscoped().Delete(&vote).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&models.Vote{BlogID: blogId, UserID: userId}).Error; err != nil {
+				return err
+			}
+			voted = true
+		default:
+			return err
 		}
-		return true, nil
+		return events.Emit(tx, events.VoteToggled{BlogID: blogId, VoterID: userId, Voted: voted})
+	})
+	if err != nil {
+		return false, err
 	}
-	return false, nil
+	s.dispatcher.Wake()
+	return voted, nil
 }
 
 func (s *Service) CheckVote(blogId, userId uint) (bool, error) {
@@ -270,35 +370,58 @@ func (s *Service) CheckVote(blogId, userId uint) (bool, error) {
 	return count > 0, nil
 }
 
-func (s *Service) CreateComment(blogId, authorId uint, comment string) (*models.Comment, error) {
+// CreateComment adds a comment to a blog, or a reply when parentId is set.
+func (s *Service) CreateComment(blogId, authorId uint, comment string, parentId *uint) (*models.Comment, error) {
+	if _, err := s.checkInteraction(blogId, authorId); err != nil {
+		return nil, err
+	}
+	if parentId != nil {
+		var count int64
+		err := s.db.Model(&models.Comment{}).Where("id=? AND blog_id=?", *parentId, blogId).Count(&count).Error
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrInvalidParent
+		}
+	}
 	newComment := &models.Comment{
 		BlogID:   blogId,
 		AuthorID: authorId,
 		Comment:  comment,
+		ParentID: parentId,
 	}
-	err := s.db.Create(&newComment).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newComment).Error; err != nil {
+			return err
+		}
+		return events.Emit(tx, events.CommentCreated{
+			CommentID: newComment.ID,
+			BlogID:    blogId,
+			AuthorID:  authorId,
+			ParentID:  parentId,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+	s.dispatcher.Wake()
 	s.db.Preload("Author").First(&newComment)
 	return newComment, nil
 }
 
-func (s *Service) GetCommentsByBlogId(blogId uint) ([]models.CommentResponse, error) {
+func (s *Service) GetCommentsByBlogId(blogId, viewerId uint) ([]models.CommentResponse, error) {
+	if _, err := s.checkInteraction(blogId, viewerId); err != nil {
+		return nil, err
+	}
 	var comments []models.Comment
-	err := s.db.Where("blog_id=?", blogId).Preload("Author").Order("created_at DESC").Find(&comments).Error
+	err := s.db.Where("blog_id=?", blogId).Scopes(block.Visible(viewerId, "author_id")).Preload("Author").Order("created_at DESC").Find(&comments).Error
 	if err != nil {
 		return nil, err
 	}
 	var response []models.CommentResponse
 	for _, comment := range comments {
-		response = append(response, models.CommentResponse{
-			ID:        comment.ID,
-			Comment:   comment.Comment,
-			AuthorID:  comment.AuthorID,
-			Author:    comment.Author.ToResponse(),
-			CreatedAt: comment.CreatedAt,
-		})
+		response = append(response, toCommentResponse(&comment))
 	}
 	return response, nil
 }
@@ -312,24 +435,57 @@ func (s *Service) DeleteComment(commentId, userId uint) error {
 	if comment.AuthorID != userId {
 		return errors.New("Unauthorized")
 	}
-	return s.db.Delete(&comment).Error
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		return events.Emit(tx, events.CommentDeleted{CommentID: comment.ID, BlogID: comment.BlogID})
+	})
+	if err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+func toCommentResponse(comment *models.Comment) models.CommentResponse {
+	return models.CommentResponse{
+		ID:        comment.ID,
+		Comment:   comment.Comment,
+		ParentID:  comment.ParentID,
+		AuthorID:  comment.AuthorID,
+		Author:    comment.Author.ToResponse(),
+		CreatedAt: comment.CreatedAt,
+	}
+}
+
+// checkInteraction stops a user from acting on a blog they aren't allowed
+// to read. It returns the blog's id, title and author.
+func (s *Service) checkInteraction(blogId, userId uint) (*models.Blog, error) {
+	var blog models.Blog
+	if err := s.db.Select("id", "title", "author_id").First(&blog, blogId).Error; err != nil {
+		return nil, err
+	}
+	if err := s.checkAccess(&blog, userId); err != nil {
+		return nil, err
+	}
+	return &blog, nil
 }
 
 func (s *Service) toBlogListResponse(blogs []models.Blog) ([]models.BlogListResponse, error) {
 	var response []models.BlogListResponse
 	for _, blog := range blogs {
-		var voteCount int64
-		s.db.Model(&models.Vote{}).Where("blog_id=?", blog.ID).Count(&voteCount)
-
 		response = append(response, models.BlogListResponse{
-			ID:        blog.ID,
-			Title:     blog.Title,
-			Genre:     blog.Genre,
-			Views:     blog.Views,
-			VoteCount: voteCount,
-			AuthorID:  blog.AuthorID,
-			Author:    blog.Author.ToResponse(),
-			CreatedAt: blog.CreatedAt,
+			ID:           blog.ID,
+			Title:        blog.Title,
+			Genre:        blog.Genre,
+			Views:        blog.Views,
+			VoteCount:    blog.VoteCount,
+			CommentCount: blog.CommentCount,
+			AuthorID:     blog.AuthorID,
+			Author:       blog.Author.ToResponse(),
+			CreatedAt:    blog.CreatedAt,
+			UpdatedAt:    blog.UpdatedAt,
 		})
 	}
 	return response, nil
@@ -0,0 +1,63 @@
+package blog
+
+import (
+	"context"
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	"gorm.io/gorm"
+)
+
+// Subscribe keeps the stored vote and comment counts and the search index,
+// pushes comment and vote changes to the live blog rooms, and revokes live subscriptions whose
+// access may have changed. Clients treat the pushes as refresh hints, so a
+// repeat after a retry is harmless.
+func (s *Service) Subscribe(d *events.Dispatcher) {
+	s.subscribeCounters(d)
+	s.subscribeSearch(d)
+	events.On(d, "realtime.comment_created", func(ctx context.Context, e events.CommentCreated) error {
+		var comment models.Comment
+		err := s.db.Preload("Author").First(&comment, e.CommentID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.broker.Publish(realtime.Event{
+			Type:    realtime.EventCommentCreated,
+			BlogID:  e.BlogID,
+			ActorID: e.AuthorID,
+		}, toCommentResponse(&comment))
+		return nil
+	})
+	events.On(d, "realtime.comment_deleted", func(ctx context.Context, e events.CommentDeleted) error {
+		s.broker.Publish(realtime.Event{
+			Type:   realtime.EventCommentDeleted,
+			BlogID: e.BlogID,
+		}, map[string]interface{}{"comment_id": e.CommentID})
+		return nil
+	})
+	events.On(d, "realtime.vote_toggled", func(ctx context.Context, e events.VoteToggled) error {
+		var votes int64
+		if err := s.db.Model(&models.Vote{}).Where("blog_id=?", e.BlogID).Count(&votes).Error; err != nil {
+			return err
+		}
+		s.broker.Publish(realtime.Event{
+			Type:    realtime.EventVoteUpdated,
+			BlogID:  e.BlogID,
+			ActorID: e.VoterID,
+		}, map[string]interface{}{"blog_id": e.BlogID, "votes": votes})
+		return nil
+	})
+	events.On(d, "realtime.access_changed", func(ctx context.Context, e events.AccessChanged) error {
+		s.broker.Revoke(realtime.Access{UserIDs: e.UserIDs, AuthorID: e.AuthorID})
+		return nil
+	})
+	events.On(d, "realtime.blog_deleted", func(ctx context.Context, e events.BlogDeleted) error {
+		s.broker.Revoke(realtime.Access{BlogID: e.BlogID})
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package blog
+
+import (
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"gorm.io/gorm"
+)
+
+// ErrPrivate is returned when a blog belongs to a private account the user
+// doesn't follow.
+var ErrPrivate = errors.New("this blog is only visible to the author's followers")
+
+// VisibleTo is a query scope over blogs that keeps only the ones viewerId
+// may read: public authors, their own posts and private authors they
+// follow, minus anyone blocked or muted. A zero viewer only sees public
+// posts.
+func VisibleTo(viewerId uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(block.Visible(viewerId, "blogs.author_id"))
+		return db.Where(
+			"(blogs.author_id NOT IN (SELECT id FROM users WHERE is_private) OR blogs.author_id = ? OR blogs.author_id IN (SELECT following_id FROM follows WHERE follower_id = ? AND deleted_at IS NULL))",
+			viewerId, viewerId)
+	}
+}
+
+// CanView returns nil when userId may read blogId, and ErrBlocked,
+// ErrPrivate or gorm.ErrRecordNotFound otherwise.
+func (s *Service) CanView(blogId, userId uint) error {
+	_, err := s.checkInteraction(blogId, userId)
+	return err
+}
+
+// checkAccess reports whether userId may read, comment on or vote on blog.
+func (s *Service) checkAccess(blog *models.Blog, userId uint) error {
+	if blog.AuthorID == userId {
+		return nil
+	}
+	if userId != 0 {
+		blocked, err := block.Between(s.db, userId, blog.AuthorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return ErrBlocked
+		}
+	}
+
+	var author models.User
+	if err := s.db.Select("id", "is_private").First(&author, blog.AuthorID).Error; err != nil {
+		return err
+	}
+	if !author.IsPrivate {
+		return nil
+	}
+	if userId == 0 {
+		return ErrPrivate
+	}
+	var count int64
+	err := s.db.Model(&models.Follows{}).Where("follower_id=? AND following_id=?", userId, blog.AuthorID).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrPrivate
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/notification"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	KindSendDigests = "digest.send_due"
+	KindSendDigest  = "digest.send"
+	runInterval     = 15 * time.Minute
+	// due users are read in batches so one tick doesn't load them all
+	batchSize = 200
+	// unsubscribe links keep working long after the digest was sent
+	unsubscribeTokenTTL = 90 * 24 * time.Hour
+	// genres count as engaged with if the user voted or commented on them
+	// this recently
+	engagementWindow = 90 * 24 * time.Hour
+
+	maxFollowedPosts = 10
+	maxTrendingPosts = 5
+	excerptLength    = 200
+)
+
+// digestJob mails one user the posts since Since. The unsubscribe token is
+// minted when it runs, so the queue never holds one.
+type digestJob struct {
+	UserID uint      `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+var ErrInvalidUnsubscribeToken = errors.New("unsubscribe link is invalid or has expired")
+
+var periods = map[string]time.Duration{
+	models.DigestDaily:  24 * time.Hour,
+	models.DigestWeekly: 7 * 24 * time.Hour,
+}
+
+type Service struct {
+	db            *gorm.DB
+	mailer        mailer.Mailer
+	keys          *utils.KeySet
+	notifications *notification.Service
+	appURL        string
+	apiURL        string
+}
+
+func NewService(db *gorm.DB, m mailer.Mailer, keys *utils.KeySet, notifications *notification.Service, appURL, apiURL string) *Service {
+	return &Service{
+		db:            db,
+		mailer:        m,
+		keys:          keys,
+		notifications: notifications,
+		appURL:        appURL,
+		apiURL:        apiURL,
+	}
+}
+
+// RegisterJobs schedules the job that queues a digest for every user whose
+// daily or weekly period is up and who isn't in their quiet hours, and the
+// job that sends each one.
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	jobs.Handle(q, KindSendDigests, func(ctx context.Context, _ struct{}) error {
+		for frequency, period := range periods {
+			s.queueDue(ctx, q, frequency, period)
+		}
+		return nil
+	})
+	jobs.Handle(q, KindSendDigest, func(ctx context.Context, p digestJob) error {
+		return s.sendQueuedDigest(ctx, p.UserID, p.Since)
+	})
+	q.Every(KindSendDigests, runInterval)
+}
+
+// SetFrequency changes how often userId gets a digest.
+func (s *Service) SetFrequency(userId uint, frequency string) error {
+	return s.db.Model(&models.User{}).Where("id=?", userId).Update("digest_frequency", frequency).Error
+}
+
+// Unsubscribe turns digests off for the user a signed unsubscribe link was
+// sent to.
+func (s *Service) Unsubscribe(token string) error {
+	claims, err := utils.ValidateActionToken(token, utils.PurposeUnsubscribe, s.keys)
+	if err != nil {
+		return ErrInvalidUnsubscribeToken
+	}
+	// a link sent to an old address must not change the new owner's settings
+	result := s.db.Model(&models.User{}).
+		Where("id=? AND email=?", claims.UserID, claims.Email).
+		Update("digest_frequency", models.DigestOff)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidUnsubscribeToken
+	}
+	return nil
+}
+
+// dueScope keeps verified users on frequency whose last digest went out
+// more than period ago.
+func dueScope(frequency string, cutoff time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("digest_frequency=? AND email_verified AND deletion_scheduled_at IS NULL", frequency).
+			Where("digest_sent_at IS NULL OR digest_sent_at <= ?", cutoff)
+	}
+}
+
+// queueDue walks every user due a digest in id order, a batch at a time,
+// so that users in their quiet hours don't hold back the ones after them.
+func (s *Service) queueDue(ctx context.Context, q *jobs.Queue, frequency string, period time.Duration) {
+	defer q.Wake()
+	cutoff := time.Now().Add(-period)
+	var after uint
+	for ctx.Err() == nil {
+		var users []models.User
+		err := s.db.Scopes(dueScope(frequency, cutoff)).
+			Where("id > ?", after).
+			Order("id").
+			Limit(batchSize).
+			Find(&users).Error
+		if err != nil {
+			log.Printf("failed to list users due a %s digest: %v", frequency, err)
+			return
+		}
+		for i := range users {
+			if ctx.Err() != nil {
+				return
+			}
+			s.queueDigest(&users[i], frequency, cutoff)
+		}
+		if len(users) < batchSize {
+			return
+		}
+		after = users[len(users)-1].ID
+	}
+}
+
+// queueDigest queues user's digest unless they are in their quiet hours.
+func (s *Service) queueDigest(user *models.User, frequency string, cutoff time.Time) {
+	// users in their quiet hours stay due and are picked up once it's over
+	pref, err := s.notifications.GetPreferences(user.ID)
+	if err != nil {
+		log.Printf("failed to get notification preferences of user %d: %v", user.ID, err)
+		return
+	}
+	if !pref.QuietUntil(time.Now()).IsZero() {
+		return
+	}
+	since := cutoff
+	if user.DigestSentAt != nil {
+		since = *user.DigestSentAt
+	}
+	// claiming the user with a conditional update lets several replicas
+	// run the job without queueing twice
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id=?", user.ID).
+			Scopes(dueScope(frequency, cutoff)).
+			Update("digest_sent_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		_, err := jobs.Enqueue(tx, KindSendDigest, digestJob{UserID: user.ID, Since: since})
+		return err
+	})
+	if err != nil {
+		log.Printf("failed to queue digest for user %d: %v", user.ID, err)
+	}
+}
+
+// sendQueuedDigest sends a queued digest unless the user stopped wanting
+// one while it waited.
+func (s *Service) sendQueuedDigest(ctx context.Context, userId uint, since time.Time) error {
+	var user models.User
+	err := s.db.First(&user, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DigestFrequency == models.DigestOff || !user.EmailVerified || user.DeletionScheduledAt != nil {
+		return nil
+	}
+	return s.sendDigest(ctx, &user, since)
+}
+
+func (s *Service) sendDigest(ctx context.Context, user *models.User, since time.Time) error {
+	followed, err := s.followedPosts(user.ID, since)
+	if err != nil {
+		return err
+	}
+	seen := make([]uint, 0, len(followed))
+	for _, b := range followed {
+		seen = append(seen, b.ID)
+	}
+	trending, err := s.trendingPosts(user.ID, since, seen)
+	if err != nil {
+		return err
+	}
+	// nothing new is not worth an email
+	if len(followed) == 0 && len(trending) == 0 {
+		return nil
+	}
+
+	token, err := utils.GenerateActionToken(utils.PurposeUnsubscribe, user.Email, user.ID, unsubscribeTokenTTL, s.keys)
+	if err != nil {
+		return err
+	}
+	data := digestData{
+		Name:           user.Name,
+		Frequency:      user.DigestFrequency,
+		Followed:       s.toEntries(followed),
+		Trending:       s.toEntries(trending),
+		SettingsURL:    s.appURL + "/settings/notifications",
+		UnsubscribeURL: fmt.Sprintf("%s/unsubscribe?token=%s", s.appURL, url.QueryEscape(token)),
+	}
+	text, html, err := render(data)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: subject(user.DigestFrequency),
+		Text:    text,
+		HTML:    html,
+		// RFC 8058 one-click unsubscribe, handled without signing in
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s/api/digest/unsubscribe?token=%s>", s.apiURL, url.QueryEscape(token)),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// followedPosts is what the authors userId follows published since.
+func (s *Service) followedPosts(userId uint, since time.Time) ([]models.Blog, error) {
+	var blogs []models.Blog
+	err := s.db.Preload("Author").
+		Scopes(blog.VisibleTo(userId)).
+		Where("blogs.author_id IN (SELECT following_id FROM follows WHERE follower_id = ? AND deleted_at IS NULL)", userId).
+		Where("blogs.created_at > ?", since).
+		Order("blogs.created_at DESC").
+		Limit(maxFollowedPosts).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+// trendingPosts is the most voted posts published since in the genres
+// userId has voted or commented on lately, leaving out their own posts and
+// the ones in exclude.
+func (s *Service) trendingPosts(userId uint, since time.Time, exclude []uint) ([]models.Blog, error) {
+	var genres []string
+	engagedAfter := time.Now().Add(-engagementWindow)
+	err := s.db.Model(&models.Blog{}).
+		Distinct("genre").
+		Where("id IN (SELECT blog_id FROM votes WHERE user_id = ? AND created_at > ? AND deleted_at IS NULL) OR id IN (SELECT blog_id FROM comments WHERE author_id = ? AND created_at > ? AND deleted_at IS NULL)",
+			userId, engagedAfter, userId, engagedAfter).
+		Pluck("genre", &genres).Error
+	if err != nil || len(genres) == 0 {
+		return nil, err
+	}
+
+	query := s.db.Preload("Author").
+		Scopes(blog.VisibleTo(userId)).
+		Where("blogs.genre IN ? AND blogs.created_at > ? AND blogs.author_id <> ?", genres, since, userId)
+	if len(exclude) > 0 {
+		query = query.Where("blogs.id NOT IN ?", exclude)
+	}
+	var blogs []models.Blog
+	err = query.
+		Order("(SELECT COUNT(*) FROM votes WHERE votes.blog_id = blogs.id AND votes.deleted_at IS NULL) DESC, blogs.views DESC").
+		Limit(maxTrendingPosts).
+		Find(&blogs).Error
+	return blogs, err
+}
+
+func (s *Service) toEntries(blogs []models.Blog) []digestEntry {
+	entries := make([]digestEntry, 0, len(blogs))
+	for _, b := range blogs {
+		entries = append(entries, digestEntry{
+			Title:   b.Title,
+			Author:  b.Author.Name,
+			Genre:   b.Genre,
+			Excerpt: utils.Excerpt(b.Content, excerptLength),
+			URL:     utils.BlogURL(s.appURL, b.ID),
+		})
+	}
+	return entries
+}
+
+func subject(frequency string) string {
+	if frequency == models.DigestDaily {
+		return "Your daily BoldNarratives digest"
+	}
+	return "Your weekly BoldNarratives digest"
+}
@@ -0,0 +1,74 @@
+package digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/notification"
+)
+
+// TestQueueDueSkipsQuietUsers fills more than a batch with users in their
+// quiet hours and checks the due users after them are still queued.
+func TestQueueDueSkipsQuietUsers(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.NotificationPreference{}, &models.Job{})
+	s := NewService(db, nil, nil, notification.NewService(db, nil, nil, ""), "https://app.test", "https://api.test")
+	q := jobs.NewQueue(db, 1)
+
+	const quiet, awake = batchSize + 10, 5
+	now := time.Now().UTC()
+	users := make([]models.User, quiet+awake)
+	for i := range users {
+		users[i] = models.User{
+			Email:           fmt.Sprintf("user%d@example.com", i),
+			Name:            "user",
+			Password:        "x",
+			EmailVerified:   true,
+			DigestFrequency: models.DigestWeekly,
+		}
+	}
+	if err := db.CreateInBatches(users, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	prefs := make([]models.NotificationPreference, quiet)
+	for i := range prefs {
+		prefs[i] = models.DefaultNotificationPreference(users[i].ID)
+		prefs[i].QuietHoursStart = now.Add(-time.Hour).Format("15:04")
+		prefs[i].QuietHoursEnd = now.Add(time.Hour).Format("15:04")
+	}
+	if err := db.CreateInBatches(prefs, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.queueDue(context.Background(), q, models.DigestWeekly, periods[models.DigestWeekly])
+
+	var queued []models.Job
+	if err := db.Where("kind=?", KindSendDigest).Order("id").Find(&queued).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != awake {
+		t.Fatalf("queued %d digests, want %d", len(queued), awake)
+	}
+	for i, job := range queued {
+		var p digestJob
+		if err := json.Unmarshal([]byte(job.Payload), &p); err != nil {
+			t.Fatal(err)
+		}
+		if want := users[quiet+i].ID; p.UserID != want {
+			t.Errorf("digest %d is for user %d, want %d", i, p.UserID, want)
+		}
+	}
+
+	// claimed users aren't due again until their period is up
+	s.queueDue(context.Background(), q, models.DigestWeekly, periods[models.DigestWeekly])
+	var count int64
+	db.Model(&models.Job{}).Where("kind=?", KindSendDigest).Count(&count)
+	if count != awake {
+		t.Fatalf("second run left %d digests queued, want %d", count, awake)
+	}
+}
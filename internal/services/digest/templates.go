@@ -0,0 +1,45 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/digest.txt"))
+)
+
+type digestEntry struct {
+	Title   string
+	Author  string
+	Genre   string
+	Excerpt string
+	URL     string
+}
+
+type digestData struct {
+	Name           string
+	Frequency      string
+	Followed       []digestEntry
+	Trending       []digestEntry
+	SettingsURL    string
+	UnsubscribeURL string
+}
+
+// render builds the text and HTML bodies of a digest.
+func render(data digestData) (text, html string, err error) {
+	var textBuf, htmlBuf bytes.Buffer
+	if err := textTemplate.Execute(&textBuf, data); err != nil {
+		return "", "", err
+	}
+	if err := htmlTemplate.Execute(&htmlBuf, data); err != nil {
+		return "", "", err
+	}
+	return textBuf.String(), htmlBuf.String(), nil
+}
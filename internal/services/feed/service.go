@@ -0,0 +1,203 @@
+package feed
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	feedLength    = 50
+	excerptLength = 300
+	siteName      = "BoldNarratives"
+)
+
+var (
+	ErrAuthorNotFound = errors.New("author not found")
+	ErrUnknownGenre   = errors.New("genre not found")
+	ErrInvalidTag     = errors.New("tag not found")
+)
+
+// Service builds syndication feeds of public blogs. Feeds are read by
+// anonymous feed readers, so they only ever carry what a signed out
+// visitor could see.
+type Service struct {
+	db          *gorm.DB
+	blogs       *blog.Service
+	appURL      string
+	apiURL      string
+	fullContent bool
+}
+
+// Feed is a format independent feed; Render turns it into RSS, Atom or
+// JSON Feed.
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	// Updated is when the newest item last changed, zero for an empty feed.
+	Updated time.Time
+	Items   []Item
+
+	// self is the feed's address without the format suffix.
+	self string
+}
+
+type Item struct {
+	ID         uint
+	Title      string
+	URL        string
+	Genre      string
+	AuthorName string
+	AuthorURL  string
+	Published  time.Time
+	Updated    time.Time
+	Summary    string
+	// HTML is the full post, empty when feeds only carry excerpts.
+	HTML string
+}
+
+func NewService(db *gorm.DB, blogs *blog.Service, appURL, apiURL string, fullContent bool) *Service {
+	return &Service{db: db, blogs: blogs, appURL: appURL, apiURL: apiURL, fullContent: fullContent}
+}
+
+// Latest is the feed of the newest blogs across the site.
+func (s *Service) Latest() (*Feed, error) {
+	feed := &Feed{
+		Title:       siteName,
+		Description: "The latest posts on " + siteName,
+		Link:        s.appURL,
+		self:        s.apiURL + "/api/feeds/latest",
+	}
+	return feed, s.fill(feed, blog.Filter{})
+}
+
+// ForGenre is the feed of the newest blogs in one genre.
+func (s *Service) ForGenre(genre string) (*Feed, error) {
+	if !models.IsValidGenre(genre) {
+		return nil, ErrUnknownGenre
+	}
+	feed := &Feed{
+		Title:       fmt.Sprintf("%s: %s", siteName, genre),
+		Description: fmt.Sprintf("The latest %s posts on %s", genre, siteName),
+		Link:        utils.GenreURL(s.appURL, genre),
+		self:        fmt.Sprintf("%s/api/feeds/genres/%s", s.apiURL, url.PathEscape(genre)),
+	}
+	return feed, s.fill(feed, blog.Filter{Genre: genre})
+}
+
+// ForTag is the feed of the newest blogs with a tag.
+func (s *Service) ForTag(tag string) (*Feed, error) {
+	tag = models.NormalizeTag(tag)
+	if !models.IsValidTag(tag) {
+		return nil, ErrInvalidTag
+	}
+	feed := &Feed{
+		Title:       fmt.Sprintf("%s: #%s", siteName, tag),
+		Description: fmt.Sprintf("The latest posts tagged %s on %s", tag, siteName),
+		Link:        utils.TagURL(s.appURL, tag),
+		self:        fmt.Sprintf("%s/api/feeds/tags/%s", s.apiURL, url.PathEscape(tag)),
+	}
+	return feed, s.fill(feed, blog.Filter{Tag: tag})
+}
+
+// ForAuthor is the feed of one author's newest blogs. Private authors
+// only share with followers, so they have no feed.
+func (s *Service) ForAuthor(authorId uint) (*Feed, error) {
+	var author models.User
+	if err := s.db.Select("id", "name", "is_private").First(&author, authorId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAuthorNotFound
+		}
+		return nil, err
+	}
+	if author.IsPrivate {
+		return nil, blog.ErrPrivate
+	}
+	feed := &Feed{
+		Title:       fmt.Sprintf("%s on %s", author.Name, siteName),
+		Description: fmt.Sprintf("The latest posts by %s on %s", author.Name, siteName),
+		Link:        utils.AuthorURL(s.appURL, author.ID),
+		self:        fmt.Sprintf("%s/api/feeds/authors/%d", s.apiURL, author.ID),
+	}
+	return feed, s.fill(feed, blog.Filter{AuthorID: &author.ID})
+}
+
+// fill loads the newest blogs matching filter into feed.
+func (s *Service) fill(feed *Feed, filter blog.Filter) error {
+	filter.Limit = feedLength
+	blogs, err := s.blogs.GetBlogsSortedByTime(filter, false)
+	if err != nil {
+		return err
+	}
+	content, err := s.content(blogs)
+	if err != nil {
+		return err
+	}
+
+	feed.Items = make([]Item, 0, len(blogs))
+	for _, b := range blogs {
+		item := Item{
+			ID:         b.ID,
+			Title:      b.Title,
+			URL:        utils.BlogURL(s.appURL, b.ID),
+			Genre:      b.Genre,
+			AuthorName: b.Author.Name,
+			AuthorURL:  utils.AuthorURL(s.appURL, b.AuthorID),
+			Published:  b.CreatedAt,
+			Updated:    b.UpdatedAt,
+			Summary:    utils.Excerpt(content[b.ID], excerptLength),
+		}
+		if s.fullContent {
+			item.HTML = toHTML(content[b.ID])
+		}
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return nil
+}
+
+// content loads the bodies the list query leaves out.
+func (s *Service) content(blogs []models.BlogListResponse) (map[uint]string, error) {
+	ids := make([]uint, 0, len(blogs))
+	for _, b := range blogs {
+		ids = append(ids, b.ID)
+	}
+	content := make(map[uint]string, len(ids))
+	if len(ids) == 0 {
+		return content, nil
+	}
+	var rows []models.Blog
+	if err := s.db.Select("id", "content").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		content[row.ID] = row.Content
+	}
+	return content, nil
+}
+
+// toHTML turns a plain text post into escaped HTML paragraphs.
+func toHTML(content string) string {
+	var b strings.Builder
+	for _, para := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(para), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
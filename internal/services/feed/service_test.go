@@ -0,0 +1,65 @@
+package feed
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+)
+
+func TestForTag(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.Blog{}, &models.BlogTag{}, &models.Comment{}, &models.Vote{}, &models.Follows{})
+	s := NewService(db, blog.NewService(db, nil, nil), "https://app.test", "https://api.test", false)
+
+	newUser := func(email string, private bool) *models.User {
+		u := &models.User{Email: email, Name: email, Password: "x"}
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+		if private {
+			db.Model(u).Update("is_private", true)
+		}
+		return u
+	}
+	newBlog := func(author *models.User, tags ...string) *models.Blog {
+		b := &models.Blog{Title: "t", Content: "c", Genre: "Technology", AuthorID: author.ID}
+		if err := db.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+		for _, tag := range tags {
+			if err := db.Create(&models.BlogTag{BlogID: b.ID, Tag: tag}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		return b
+	}
+
+	ann := newUser("ann@example.com", false)
+	tagged := newBlog(ann, "go", "postgres")
+	newBlog(ann, "postgres")
+	newBlog(ann)
+	// posts a signed out visitor can't read stay out of the feed
+	newBlog(newUser("bob@example.com", true), "go")
+	db.Delete(newBlog(ann, "go"))
+
+	f, err := s.ForTag(" Go")
+	if err != nil {
+		t.Fatalf("ForTag: %v", err)
+	}
+	if len(f.Items) != 1 || f.Items[0].ID != tagged.ID {
+		t.Fatalf("items = %+v, want blog %d", f.Items, tagged.ID)
+	}
+	if f.Link != "https://app.test/tag/go" || f.self != "https://api.test/api/feeds/tags/go" {
+		t.Errorf("links = %q, %q", f.Link, f.self)
+	}
+
+	f, err = s.ForTag("unused")
+	if err != nil || len(f.Items) != 0 {
+		t.Fatalf("unused tag = %+v, %v", f, err)
+	}
+	if _, err := s.ForTag("not a tag"); !errors.Is(err, ErrInvalidTag) {
+		t.Fatalf("invalid tag = %v, want ErrInvalidTag", err)
+	}
+}
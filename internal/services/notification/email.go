@@ -0,0 +1,139 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	KindSendEmails = "notification.send_emails"
+	KindSendEmail  = "notification.send_email"
+	emailInterval  = time.Minute
+	emailBatchSize = 200
+)
+
+type emailJob struct {
+	NotificationID uint `json:"notification_id"`
+}
+
+// RegisterJobs schedules the job that queues notification emails as they
+// fall due, holding each one back until the recipient's quiet hours are
+// over, and the job that sends each one.
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	jobs.Handle(q, KindSendEmails, func(ctx context.Context, _ struct{}) error {
+		s.queueDueEmails(ctx, q)
+		return nil
+	})
+	jobs.Handle(q, KindSendEmail, func(ctx context.Context, p emailJob) error {
+		return s.sendEmail(ctx, p.NotificationID)
+	})
+	q.Every(KindSendEmails, emailInterval)
+}
+
+func (s *Service) queueDueEmails(ctx context.Context, q *jobs.Queue) {
+	var due []models.Notification
+	err := s.db.
+		Where("email_due_at <= ?", time.Now()).
+		Order("email_due_at").
+		Limit(emailBatchSize).
+		Find(&due).Error
+	if err != nil {
+		log.Printf("failed to list due notification emails: %v", err)
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.queueEmail(&due[i]); err != nil {
+			log.Printf("failed to queue email for notification %d: %v", due[i].ID, err)
+		}
+	}
+	q.Wake()
+}
+
+func (s *Service) queueEmail(n *models.Notification) error {
+	pref, err := s.GetPreferences(n.UserID)
+	if err != nil {
+		return err
+	}
+	if until := pref.QuietUntil(time.Now()); !until.IsZero() {
+		return s.db.Model(&models.Notification{}).Where("id=?", n.ID).Update("email_due_at", until).Error
+	}
+
+	// claiming the row with a conditional update lets several replicas run
+	// the job without queueing twice; email-only rows are done once sent
+	updates := map[string]interface{}{"email_due_at": nil}
+	if n.EmailOnly {
+		updates["read_at"] = time.Now()
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Notification{}).
+			Where("id=? AND email_due_at IS NOT NULL", n.ID).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		_, err := jobs.Enqueue(tx, KindSendEmail, emailJob{NotificationID: n.ID})
+		return err
+	})
+}
+
+func (s *Service) sendEmail(ctx context.Context, notificationId uint) error {
+	var n models.Notification
+	err := s.db.
+		Preload("Actor").
+		Preload("Blog", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Select("id", "title")
+		}).
+		First(&n, notificationId).Error
+	// the recipient may have deleted it, or their account, since
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pref, err := s.GetPreferences(n.UserID)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := s.db.First(&user, n.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	// the user may have turned email off since, and unverified addresses
+	// never get mail
+	if !wantsEmail(pref.Channel(n.Type)) || !user.EmailVerified || user.DeletionScheduledAt != nil {
+		return nil
+	}
+
+	text := message(&n)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: text,
+		Text: fmt.Sprintf("Hi %s,\n\n%s.\n\n%s\n\nChoose which emails you get: %s/settings/notifications\n",
+			user.Name, text, s.link(&n), s.appURL),
+	})
+}
+
+// link is where the email points the recipient.
+func (s *Service) link(n *models.Notification) string {
+	if n.BlogID != nil {
+		return utils.BlogURL(s.appURL, *n.BlogID)
+	}
+	return s.appURL + "/notifications"
+}
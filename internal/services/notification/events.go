@@ -0,0 +1,179 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+)
+
+// mentionPattern finds @handles that aren't part of an email address or a
+// longer word.
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9_@.])@([A-Za-z0-9_]{3,30})\b`)
+
+// The methods below run from the outbox subscribers in subscribe.go after
+// the action they describe has been saved. An error makes the dispatcher
+// retry, and a retry folds into the notifications already sent.
+
+func (s *Service) Followed(followerId, followingId uint) error {
+	return s.notify(&models.Notification{
+		UserID:   followingId,
+		Type:     models.NotifyFollow,
+		GroupKey: "follow",
+		ActorID:  followerId,
+	})
+}
+
+func (s *Service) FollowRequested(requesterId, targetId uint) error {
+	return s.notify(&models.Notification{
+		UserID:   targetId,
+		Type:     models.NotifyFollowRequest,
+		GroupKey: "follow_request",
+		ActorID:  requesterId,
+	})
+}
+
+func (s *Service) Voted(voterId uint, blog *models.Blog) error {
+	return s.notify(&models.Notification{
+		UserID:   blog.AuthorID,
+		Type:     models.NotifyVote,
+		GroupKey: fmt.Sprintf("vote:%d", blog.ID),
+		ActorID:  voterId,
+		BlogID:   &blog.ID,
+	})
+}
+
+// Commented notifies the blog's author of a new comment, or the parent
+// comment's author of a reply, and anyone mentioned in it.
+func (s *Service) Commented(comment *models.Comment, blog *models.Blog) error {
+	notified := map[uint]bool{comment.AuthorID: true}
+	var errs []error
+
+	if comment.ParentID != nil {
+		var parent models.Comment
+		if err := s.db.Select("id", "author_id").First(&parent, *comment.ParentID).Error; err != nil {
+			errs = append(errs, err)
+		} else {
+			errs = append(errs, s.notify(&models.Notification{
+				UserID:    parent.AuthorID,
+				Type:      models.NotifyReply,
+				GroupKey:  fmt.Sprintf("reply:%d", parent.ID),
+				ActorID:   comment.AuthorID,
+				BlogID:    &blog.ID,
+				CommentID: &comment.ID,
+			}))
+			notified[parent.AuthorID] = true
+		}
+	}
+	if !notified[blog.AuthorID] {
+		errs = append(errs, s.notify(&models.Notification{
+			UserID:    blog.AuthorID,
+			Type:      models.NotifyComment,
+			GroupKey:  fmt.Sprintf("comment:%d", blog.ID),
+			ActorID:   comment.AuthorID,
+			BlogID:    &blog.ID,
+			CommentID: &comment.ID,
+		}))
+		notified[blog.AuthorID] = true
+	}
+
+	errs = append(errs, s.mentioned(comment.Comment, comment.AuthorID, blog, &comment.ID, notified))
+	return errors.Join(errs...)
+}
+
+// Published tells the author's followers about a new blog, as each of
+// them prefers, and notifies anyone mentioned in it. Followers who already
+// have the notification are skipped, so it is safe to retry.
+func (s *Service) Published(blog *models.Blog) error {
+	now := time.Now()
+	groupKey := fmt.Sprintf("post:%d", blog.ID)
+	var recipients []struct {
+		UserID    uint
+		EmailOnly bool
+	}
+	err := s.db.Raw(`
+		INSERT INTO notifications (user_id, type, group_key, actor_id, actor_count, blog_id, email_only, email_due_at, created_at, updated_at)
+		SELECT f.follower_id, ?, ?, f.following_id, 1, ?, c.channel = ?, CASE WHEN c.channel IN ? THEN ?::timestamptz END, ?, ?
+		FROM follows f
+		CROSS JOIN LATERAL (
+			SELECT COALESCE((SELECT posts FROM notification_preferences p WHERE p.user_id = f.follower_id), ?) AS channel
+		) c
+		WHERE f.following_id = ? AND f.deleted_at IS NULL AND c.channel <> ?
+			AND f.follower_id NOT IN (SELECT muter_id FROM mutes WHERE muted_id = ?)
+			AND NOT EXISTS (SELECT 1 FROM notifications n WHERE n.user_id = f.follower_id AND n.group_key = ?)
+		RETURNING user_id, email_only`,
+		models.NotifyNewPost, groupKey, blog.ID,
+		models.ChannelEmail, []string{models.ChannelEmail, models.ChannelAll}, now, now, now,
+		models.ChannelInApp, blog.AuthorID, models.ChannelNone, blog.AuthorID, groupKey).Scan(&recipients).Error
+	if err != nil {
+		return err
+	}
+
+	// followers can be many, so they get a bare event and refetch the count
+	for _, r := range recipients {
+		if !r.EmailOnly {
+			s.broker.Publish(realtime.Event{Type: realtime.EventNotification, UserID: r.UserID}, liveNotification{Type: models.NotifyNewPost})
+		}
+	}
+
+	return s.mentioned(blog.Content, blog.AuthorID, blog, nil, map[uint]bool{blog.AuthorID: true})
+}
+
+// mentioned notifies users @mentioned in text who can read blog and
+// haven't already been notified about it.
+func (s *Service) mentioned(text string, actorId uint, blog *models.Blog, commentId *uint, notified map[uint]bool) error {
+	handles := parseMentions(text)
+	if len(handles) == 0 {
+		return nil
+	}
+	var recipients []uint
+	err := s.db.Model(&models.User{}).
+		Where("handle IN ?", handles).
+		Where(`(NOT EXISTS (SELECT 1 FROM users a WHERE a.id = ? AND a.is_private)
+			OR users.id = ?
+			OR users.id IN (SELECT follower_id FROM follows WHERE following_id = ? AND deleted_at IS NULL))`,
+			blog.AuthorID, blog.AuthorID, blog.AuthorID).
+		Pluck("id", &recipients).Error
+	if err != nil {
+		return err
+	}
+
+	groupKey := fmt.Sprintf("mention:blog:%d", blog.ID)
+	if commentId != nil {
+		groupKey = fmt.Sprintf("mention:comment:%d", *commentId)
+	}
+	var errs []error
+	for _, id := range recipients {
+		if notified[id] {
+			continue
+		}
+		notified[id] = true
+		errs = append(errs, s.notify(&models.Notification{
+			UserID:    id,
+			Type:      models.NotifyMention,
+			GroupKey:  groupKey,
+			ActorID:   actorId,
+			BlogID:    &blog.ID,
+			CommentID: commentId,
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+// parseMentions returns the distinct lowercased handles mentioned in text.
+func parseMentions(text string) []string {
+	seen := map[string]bool{}
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		handle := strings.ToLower(m[1])
+		if !seen[handle] {
+			seen[handle] = true
+			handles = append(handles, handle)
+		}
+	}
+	return handles
+}
@@ -0,0 +1,30 @@
+package notification
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: nil},
+		{text: "no mentions here", want: nil},
+		{text: "@ann", want: []string{"ann"}},
+		{text: "thanks @Bob_1, and (@cat).", want: []string{"bob_1", "cat"}},
+		{text: "@ann @bob @ANN", want: []string{"ann", "bob"}},
+		{text: "mail ann@example.com", want: nil},
+		{text: "@@ann", want: nil},
+		{text: "@ab is too short", want: nil},
+		{text: "@" + strings.Repeat("a", 30), want: []string{strings.Repeat("a", 30)}},
+		{text: "@" + strings.Repeat("a", 31), want: nil},
+	}
+	for _, tt := range tests {
+		if got := parseMentions(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseMentions(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package notification
+
+import (
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrQuietHoursIncomplete = errors.New("quiet hours need both a start and an end")
+
+// PreferencesUpdate changes the preferences that are set and leaves the
+// rest alone. Empty quiet hours turn them off.
+type PreferencesUpdate struct {
+	Follows         *string
+	Votes           *string
+	Comments        *string
+	Replies         *string
+	Mentions        *string
+	Posts           *string
+	Digests         *string
+	QuietHoursStart *string
+	QuietHoursEnd   *string
+	TimeZone        *string
+}
+
+// GetPreferences returns userId's saved preferences, or the defaults if
+// they never changed them.
+func (s *Service) GetPreferences(userId uint) (*models.NotificationPreference, error) {
+	return getPreferences(s.db, userId)
+}
+
+func getPreferences(db *gorm.DB, userId uint) (*models.NotificationPreference, error) {
+	var pref models.NotificationPreference
+	err := db.Where("user_id=?", userId).First(&pref).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		pref = models.DefaultNotificationPreference(userId)
+		return &pref, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pref, nil
+}
+
+func (s *Service) GetPreferencesResponse(userId uint) (*models.NotificationPreferencesResponse, error) {
+	pref, err := s.GetPreferences(userId)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := s.db.Select("digest_frequency").First(&user, userId).Error; err != nil {
+		return nil, err
+	}
+	return &models.NotificationPreferencesResponse{
+		NotificationPreference: *pref,
+		Digests:                user.DigestFrequency,
+	}, nil
+}
+
+func (s *Service) UpdatePreferences(userId uint, update PreferencesUpdate) (*models.NotificationPreferencesResponse, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		pref, err := getPreferences(tx, userId)
+		if err != nil {
+			return err
+		}
+		for _, field := range []struct {
+			value *string
+			dest  *string
+		}{
+			{update.Follows, &pref.Follows},
+			{update.Votes, &pref.Votes},
+			{update.Comments, &pref.Comments},
+			{update.Replies, &pref.Replies},
+			{update.Mentions, &pref.Mentions},
+			{update.Posts, &pref.Posts},
+			{update.QuietHoursStart, &pref.QuietHoursStart},
+			{update.QuietHoursEnd, &pref.QuietHoursEnd},
+			{update.TimeZone, &pref.TimeZone},
+		} {
+			if field.value != nil {
+				*field.dest = *field.value
+			}
+		}
+		if (pref.QuietHoursStart == "") != (pref.QuietHoursEnd == "") {
+			return ErrQuietHoursIncomplete
+		}
+		if pref.TimeZone == "" {
+			pref.TimeZone = "UTC"
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(pref).Error; err != nil {
+			return err
+		}
+
+		if update.Digests != nil {
+			return tx.Model(&models.User{}).Where("id=?", userId).Update("digest_frequency", *update.Digests).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferencesResponse(userId)
+}
+
+func wantsEmail(channel string) bool {
+	return channel == models.ChannelEmail || channel == models.ChannelAll
+}
@@ -0,0 +1,216 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/realtime"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+type Service struct {
+	db     *gorm.DB
+	broker *realtime.Broker
+	mailer mailer.Mailer
+	appURL string
+}
+
+func NewService(db *gorm.DB, broker *realtime.Broker, m mailer.Mailer, appURL string) *Service {
+	return &Service{
+		db:     db,
+		broker: broker,
+		mailer: m,
+		appURL: appURL,
+	}
+}
+
+// pushed to the recipient's live connections whenever they get a
+// notification
+type liveNotification struct {
+	Type   string `json:"type"`
+	Unread *int64 `json:"unread,omitempty"`
+}
+
+// notify stores n, or folds it into the recipient's unread notification
+// with the same group key. Nobody is notified about their own actions or
+// by people they blocked, were blocked by or muted, and the recipient's
+// preferences decide whether it shows in-app, is emailed or is dropped.
+// A collapsed group is emailed at most once while it stays unread.
+func (s *Service) notify(n *models.Notification) error {
+	if n.UserID == n.ActorID {
+		return nil
+	}
+	suppressed, err := s.suppressed(n.UserID, n.ActorID)
+	if err != nil || suppressed {
+		return err
+	}
+	pref, err := s.GetPreferences(n.UserID)
+	if err != nil {
+		return err
+	}
+	channel := pref.Channel(n.Type)
+	if channel == models.ChannelNone {
+		return nil
+	}
+	n.EmailOnly = channel == models.ChannelEmail
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.Notification
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id=? AND group_key=? AND email_only=? AND read_at IS NULL", n.UserID, n.GroupKey, n.EmailOnly).
+			Order("id DESC").
+			First(&existing).Error
+		if err == nil {
+			added := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.NotificationActor{NotificationID: existing.ID, ActorID: n.ActorID})
+			if added.Error != nil {
+				return added.Error
+			}
+			updates := map[string]interface{}{
+				"actor_id":   n.ActorID,
+				"updated_at": time.Now(),
+			}
+			if added.RowsAffected > 0 {
+				updates["actor_count"] = gorm.Expr("actor_count + 1")
+			}
+			return tx.Model(&existing).Updates(updates).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		n.ActorCount = 1
+		if wantsEmail(channel) {
+			now := time.Now()
+			n.EmailDueAt = &now
+		}
+		if err := tx.Create(n).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.NotificationActor{NotificationID: n.ID, ActorID: n.ActorID}).Error
+	})
+	if err != nil || n.EmailOnly {
+		return err
+	}
+
+	live := liveNotification{Type: n.Type}
+	if unread, err := s.UnreadCount(n.UserID); err == nil {
+		live.Unread = &unread
+	}
+	s.broker.Publish(realtime.Event{Type: realtime.EventNotification, UserID: n.UserID}, live)
+	return nil
+}
+
+func (s *Service) suppressed(recipientId, actorId uint) (bool, error) {
+	blocked, err := block.Between(s.db, recipientId, actorId)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	var muted int64
+	err = s.db.Model(&models.Mute{}).Where("muter_id=? AND muted_id=?", recipientId, actorId).Count(&muted).Error
+	return muted > 0, err
+}
+
+func (s *Service) ListNotifications(userId uint, unreadOnly bool, skip, limit int) ([]models.NotificationResponse, int64, error) {
+	query := s.db.Model(&models.Notification{}).Where("user_id=? AND NOT email_only", userId)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notifications []models.Notification
+	err := query.
+		Preload("Actor").
+		Preload("Blog", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Select("id", "title")
+		}).
+		Order("updated_at DESC, id DESC").
+		Offset(skip).
+		Limit(limit).
+		Find(&notifications).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response := make([]models.NotificationResponse, 0, len(notifications))
+	for _, n := range notifications {
+		response = append(response, models.NotificationResponse{
+			ID:         n.ID,
+			Type:       n.Type,
+			Message:    message(&n),
+			Actor:      n.Actor.ToResponse(),
+			ActorCount: n.ActorCount,
+			BlogID:     n.BlogID,
+			CommentID:  n.CommentID,
+			Read:       n.ReadAt != nil,
+			CreatedAt:  n.CreatedAt,
+			UpdatedAt:  n.UpdatedAt,
+		})
+	}
+	return response, total, nil
+}
+
+func (s *Service) UnreadCount(userId uint) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.Notification{}).Where("user_id=? AND NOT email_only AND read_at IS NULL", userId).Count(&count).Error
+	return count, err
+}
+
+func (s *Service) MarkRead(userId, notificationId uint) error {
+	var n models.Notification
+	err := s.db.Select("id", "read_at").Where("id=? AND user_id=? AND NOT email_only", notificationId, userId).First(&n).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotificationNotFound
+	}
+	if err != nil || n.ReadAt != nil {
+		return err
+	}
+	return s.db.Model(&n).Update("read_at", time.Now()).Error
+}
+
+// MarkAllRead returns how many notifications were marked.
+func (s *Service) MarkAllRead(userId uint) (int64, error) {
+	result := s.db.Model(&models.Notification{}).
+		Where("user_id=? AND NOT email_only AND read_at IS NULL", userId).
+		Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+func message(n *models.Notification) string {
+	who := n.Actor.Name
+	if n.ActorCount > 1 {
+		who = fmt.Sprintf("%d people", n.ActorCount)
+	}
+	title := "a post"
+	if n.Blog != nil {
+		title = fmt.Sprintf("%q", n.Blog.Title)
+	}
+
+	switch n.Type {
+	case models.NotifyFollow:
+		return who + " followed you"
+	case models.NotifyFollowRequest:
+		return who + " asked to follow you"
+	case models.NotifyVote:
+		return fmt.Sprintf("%s voted on %s", who, title)
+	case models.NotifyComment:
+		return fmt.Sprintf("%s commented on %s", who, title)
+	case models.NotifyReply:
+		return fmt.Sprintf("%s replied to your comment on %s", who, title)
+	case models.NotifyMention:
+		return fmt.Sprintf("%s mentioned you in %s", who, title)
+	case models.NotifyNewPost:
+		return fmt.Sprintf("%s published %s", who, title)
+	}
+	return who + " interacted with you"
+}
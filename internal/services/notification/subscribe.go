@@ -0,0 +1,61 @@
+package notification
+
+import (
+	"context"
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+// Subscribe registers the notification service's reactions to domain
+// events. Events about blogs or comments that have since been deleted are
+// dropped.
+func (s *Service) Subscribe(d *events.Dispatcher) {
+	events.On(d, "notifications.followed", func(ctx context.Context, e events.UserFollowed) error {
+		// the target approved the request themselves
+		if e.Approved {
+			return nil
+		}
+		return s.Followed(e.FollowerID, e.FollowingID)
+	})
+	events.On(d, "notifications.follow_requested", func(ctx context.Context, e events.FollowRequested) error {
+		return s.FollowRequested(e.RequesterID, e.TargetID)
+	})
+	events.On(d, "notifications.voted", func(ctx context.Context, e events.VoteToggled) error {
+		if !e.Voted {
+			return nil
+		}
+		var blog models.Blog
+		if err := s.db.Select("id", "title", "author_id").First(&blog, e.BlogID).Error; err != nil {
+			return ignoreNotFound(err)
+		}
+		return s.Voted(e.VoterID, &blog)
+	})
+	events.On(d, "notifications.commented", func(ctx context.Context, e events.CommentCreated) error {
+		var comment models.Comment
+		if err := s.db.First(&comment, e.CommentID).Error; err != nil {
+			return ignoreNotFound(err)
+		}
+		var blog models.Blog
+		if err := s.db.Select("id", "title", "author_id").First(&blog, e.BlogID).Error; err != nil {
+			return ignoreNotFound(err)
+		}
+		return s.Commented(&comment, &blog)
+	})
+	events.On(d, "notifications.published", func(ctx context.Context, e events.BlogPublished) error {
+		var blog models.Blog
+		if err := s.db.First(&blog, e.BlogID).Error; err != nil {
+			return ignoreNotFound(err)
+		}
+		return s.Published(&blog)
+	})
+}
+
+func ignoreNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
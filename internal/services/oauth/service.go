@@ -0,0 +1,337 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/config"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StateTTL is how long a user has to finish logging in at the provider.
+const StateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrInvalidState    = errors.New("login request is invalid or has expired")
+	ErrMissingEmail    = errors.New("the provider did not share an email address")
+	ErrUnverifiedEmail = errors.New("the provider has not verified this email address, sign in with your password to link it")
+)
+
+type provider struct {
+	cfg         config.OIDCProvider
+	redirectURL string
+
+	// discovery is done on first use so a provider that is down at startup
+	// doesn't stop the server
+	mu       sync.Mutex
+	oidc     *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+}
+
+type Service struct {
+	db        *gorm.DB
+	providers map[string]*provider
+}
+
+// NewService registers each configured provider. Callbacks come back to
+// {apiURL}/api/auth/{name}/callback.
+func NewService(db *gorm.DB, providers []config.OIDCProvider, apiURL string) *Service {
+	s := &Service{
+		db:        db,
+		providers: make(map[string]*provider, len(providers)),
+	}
+	for _, p := range providers {
+		s.providers[p.Name] = &provider{
+			cfg:         p,
+			redirectURL: fmt.Sprintf("%s/api/auth/%s/callback", apiURL, p.Name),
+		}
+	}
+	return s
+}
+
+func (s *Service) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (p *provider) load(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oidc == nil {
+		discovered, err := oidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discovering %s: %w", p.cfg.Name, err)
+		}
+		p.oidc = discovered
+		p.verifier = discovered.Verifier(&oidc.Config{ClientID: p.cfg.ClientID})
+	}
+	return &oauth2.Config{
+		ClientID:     p.cfg.ClientID,
+		ClientSecret: p.cfg.ClientSecret,
+		RedirectURL:  p.redirectURL,
+		Endpoint:     p.oidc.Endpoint(),
+		Scopes:       p.cfg.Scopes,
+	}, p.verifier, nil
+}
+
+// AuthCodeURL starts an authorization-code flow with PKCE and returns where
+// to send the browser, and the state the browser must present again on
+// the callback.
+func (s *Service) AuthCodeURL(ctx context.Context, providerName string) (authURL, state string, err error) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+	oauthCfg, _, err := p.load(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err = utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.db.Create(&models.OAuthState{
+		State:        utils.HashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(StateTTL),
+	}).Error
+	if err != nil {
+		return "", "", err
+	}
+	// opportunistic cleanup of flows that were never finished
+	s.db.Where("expires_at < ?", time.Now()).Delete(&models.OAuthState{})
+
+	return oauthCfg.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), state, nil
+}
+
+type idTokenClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+	Nonce         string      `json:"nonce"`
+}
+
+// some providers send email_verified as the string "true"
+func (c idTokenClaims) emailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Callback finishes the flow and returns the signed-in user, creating or
+// linking an account as needed. browserState is the state the browser that
+// started the flow kept, so a callback can't be replayed in someone else's
+// browser to sign them into the attacker's account.
+func (s *Service) Callback(ctx context.Context, providerName, state, browserState, code string) (*models.User, error) {
+	p, ok := s.providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	if browserState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, ErrInvalidState
+	}
+	pending, err := s.consumeState(providerName, state)
+	if err != nil {
+		return nil, err
+	}
+	subject, claims, err := p.exchange(ctx, code, pending)
+	if err != nil {
+		return nil, err
+	}
+	return s.resolveUser(providerName, subject, claims)
+}
+
+// exchange redeems the code and returns the subject and claims of the
+// verified ID token.
+func (p *provider) exchange(ctx context.Context, code string, pending *models.OAuthState) (string, idTokenClaims, error) {
+	var claims idTokenClaims
+	oauthCfg, verifier, err := p.load(ctx)
+	if err != nil {
+		return "", claims, err
+	}
+
+	token, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(pending.CodeVerifier))
+	if err != nil {
+		return "", claims, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return "", claims, errors.New("token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return "", claims, fmt.Errorf("verifying id_token: %w", err)
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return "", claims, err
+	}
+	if claims.Nonce != pending.Nonce {
+		return "", claims, ErrInvalidState
+	}
+	return idToken.Subject, claims, nil
+}
+
+// consumeState deletes the stored state so it can't be replayed.
+func (s *Service) consumeState(providerName, state string) (*models.OAuthState, error) {
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+	var rows []models.OAuthState
+	err := s.db.Clauses(clause.Returning{}).
+		Where("state=?", utils.HashToken(state)).
+		Delete(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, ErrInvalidState
+	}
+	pending := rows[0]
+	if pending.Provider != providerName || time.Now().After(pending.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+	return &pending, nil
+}
+
+func (s *Service) resolveUser(providerName, subject string, claims idTokenClaims) (*models.User, error) {
+	var identity models.UserIdentity
+	err := s.db.Where("provider=? AND subject=?", providerName, subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := s.db.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" {
+		return nil, ErrMissingEmail
+	}
+
+	var user models.User
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("email=?", email).First(&user).Error
+		switch {
+		case err == nil:
+			// only link when the provider vouches for the address, otherwise
+			// anyone could claim an existing account
+			if !claims.emailVerified() {
+				return ErrUnverifiedEmail
+			}
+			if !user.EmailVerified {
+				if err := takeOver(tx, &user); err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := createUser(tx, &user, email, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  subject,
+			Email:    email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// takeOver hands an account that never proved its address to the person
+// the provider says owns it. Whoever signed up with the address before
+// could have been squatting it, so their password, sessions and tokens
+// stop working.
+func takeOver(tx *gorm.DB, user *models.User) error {
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPasswod(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = tx.Model(user).Updates(map[string]interface{}{
+		"password":          hashedPassword,
+		"token_version":     gorm.Expr("token_version + 1"),
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := session.RevokeAll(tx, user.ID); err != nil {
+		return err
+	}
+	return tx.Model(&models.PersonalAccessToken{}).
+		Where("user_id=? AND revoked_at IS NULL", user.ID).
+		Update("revoked_at", now).Error
+}
+
+func createUser(tx *gorm.DB, user *models.User, email string, claims idTokenClaims) error {
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = strings.SplitN(email, "@", 2)[0]
+	}
+	// the account has no usable password until the user resets one
+	password, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPasswod(password)
+	if err != nil {
+		return err
+	}
+
+	*user = models.User{
+		Email:         email,
+		Name:          name,
+		Password:      hashedPassword,
+		EmailVerified: claims.emailVerified(),
+	}
+	if user.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	return tx.Create(user).Error
+}
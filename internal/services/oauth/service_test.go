@@ -0,0 +1,327 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/config"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal OpenID Connect provider. It issues one code,
+// checks the PKCE verifier against the challenge it was given and answers
+// with an ID token carrying claims.
+type mockProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	signer *rsa.PrivateKey
+
+	mu        sync.Mutex
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{key: key, signer: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.URL,
+			"authorization_endpoint":                m.URL + "/authorize",
+			"token_endpoint":                        m.URL + "/token",
+			"jwks_uri":                              m.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, m.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(m.signer)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// expect prepares the provider for a login whose authorization request
+// carried challenge, answering with claims on top of the standard ones.
+func (m *mockProvider) expect(challenge string, claims jwt.MapClaims) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.challenge = challenge
+	m.signer = m.key
+	m.claims = jwt.MapClaims{
+		"iss": m.URL,
+		"aud": "client",
+		"sub": "subject-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		m.claims[k] = v
+	}
+}
+
+func (m *mockProvider) config() config.OIDCProvider {
+	return config.OIDCProvider{Name: "mock", Issuer: m.URL, ClientID: "client", ClientSecret: "secret", Scopes: []string{"openid", "email"}}
+}
+
+func challengeFor(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestProviderExchange(t *testing.T) {
+	mock := newMockProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := &models.OAuthState{CodeVerifier: "verifier-with-enough-entropy-0123456789", Nonce: "nonce-1"}
+
+	tests := []struct {
+		name       string
+		code       string
+		challenge  string
+		claims     jwt.MapClaims
+		signer     *rsa.PrivateKey
+		wantErr    bool
+		wantErrIs  error
+		wantEmail  string
+		wantVerify bool
+	}{
+		{
+			name:       "valid",
+			code:       "good-code",
+			claims:     jwt.MapClaims{"nonce": "nonce-1", "email": "ann@example.com", "email_verified": true},
+			wantEmail:  "ann@example.com",
+			wantVerify: true,
+		},
+		{
+			name:       "email_verified as a string",
+			code:       "good-code",
+			claims:     jwt.MapClaims{"nonce": "nonce-1", "email": "ann@example.com", "email_verified": "true"},
+			wantEmail:  "ann@example.com",
+			wantVerify: true,
+		},
+		{
+			name:      "unverified email",
+			code:      "good-code",
+			claims:    jwt.MapClaims{"nonce": "nonce-1", "email": "ann@example.com", "email_verified": false},
+			wantEmail: "ann@example.com",
+		},
+		{
+			name:      "nonce mismatch",
+			code:      "good-code",
+			claims:    jwt.MapClaims{"nonce": "someone-elses", "email": "ann@example.com"},
+			wantErr:   true,
+			wantErrIs: ErrInvalidState,
+		},
+		{
+			name:    "wrong PKCE verifier",
+			code:    "good-code",
+			claims:  jwt.MapClaims{"nonce": "nonce-1"},
+			wantErr: true,
+			// the provider was told about a different challenge
+			challenge: challengeFor("another-verifier"),
+		},
+		{
+			name:    "unknown code",
+			code:    "bad-code",
+			claims:  jwt.MapClaims{"nonce": "nonce-1"},
+			wantErr: true,
+		},
+		{
+			name:    "token for another client",
+			code:    "good-code",
+			claims:  jwt.MapClaims{"nonce": "nonce-1", "aud": "someone-else"},
+			wantErr: true,
+		},
+		{
+			name:    "forged signature",
+			code:    "good-code",
+			claims:  jwt.MapClaims{"nonce": "nonce-1"},
+			signer:  otherKey,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			challenge := tt.challenge
+			if challenge == "" {
+				challenge = challengeFor(pending.CodeVerifier)
+			}
+			mock.expect(challenge, tt.claims)
+			if tt.signer != nil {
+				mock.mu.Lock()
+				mock.signer = tt.signer
+				mock.mu.Unlock()
+			}
+
+			p := &provider{cfg: mock.config(), redirectURL: "http://api.test/api/auth/mock/callback"}
+			subject, claims, err := p.exchange(context.Background(), tt.code, pending)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				if tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("got %v, want %v", err, tt.wantErrIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("exchange: %v", err)
+			}
+			if subject != "subject-1" {
+				t.Errorf("subject = %q", subject)
+			}
+			if claims.Email != tt.wantEmail || claims.emailVerified() != tt.wantVerify {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+// TestLoginRoundTrip runs a whole login against the mock provider: the
+// authorization URL, the browser bound state and the account it ends in.
+func TestLoginRoundTrip(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.UserIdentity{}, &models.OAuthState{}, &models.Session{}, &models.PersonalAccessToken{})
+	mock := newMockProvider(t)
+	s := NewService(db, []config.OIDCProvider{mock.config()}, "http://api.test")
+	ctx := context.Background()
+
+	// login starts the flow and hands back the state for the cookie
+	start := func(claims jwt.MapClaims) string {
+		t.Helper()
+		authURL, state, err := s.AuthCodeURL(ctx, "mock")
+		if err != nil {
+			t.Fatalf("AuthCodeURL: %v", err)
+		}
+		u, err := url.Parse(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if q.Get("state") != state || q.Get("code_challenge_method") != "S256" || q.Get("nonce") == "" {
+			t.Fatalf("authorization URL is missing parameters: %s", authURL)
+		}
+		claims["nonce"] = q.Get("nonce")
+		mock.expect(q.Get("code_challenge"), claims)
+		return state
+	}
+
+	t.Run("state from another browser is refused", func(t *testing.T) {
+		state := start(jwt.MapClaims{"email": "ann@example.com", "email_verified": true})
+		_, err := s.Callback(ctx, "mock", state, "attacker-state", "good-code")
+		if !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("got %v, want ErrInvalidState", err)
+		}
+		_, err = s.Callback(ctx, "mock", state, "", "good-code")
+		if !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("missing cookie: got %v, want ErrInvalidState", err)
+		}
+	})
+
+	t.Run("first login creates an account", func(t *testing.T) {
+		state := start(jwt.MapClaims{"email": "ann@example.com", "email_verified": true, "name": "Ann"})
+		user, err := s.Callback(ctx, "mock", state, state, "good-code")
+		if err != nil {
+			t.Fatalf("Callback: %v", err)
+		}
+		if user.Email != "ann@example.com" || user.Name != "Ann" || !user.EmailVerified {
+			t.Fatalf("user = %+v", user)
+		}
+
+		// the state is single use
+		if _, err := s.Callback(ctx, "mock", state, state, "good-code"); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("replay: got %v, want ErrInvalidState", err)
+		}
+
+		// the next login finds the same account through the identity
+		state = start(jwt.MapClaims{"email": "ann@example.com", "email_verified": true})
+		again, err := s.Callback(ctx, "mock", state, state, "good-code")
+		if err != nil {
+			t.Fatalf("second Callback: %v", err)
+		}
+		if again.ID != user.ID {
+			t.Fatalf("second login got user %d, want %d", again.ID, user.ID)
+		}
+	})
+
+	t.Run("unverified provider email doesn't link", func(t *testing.T) {
+		db.Create(&models.User{Email: "bob@example.com", Name: "Bob", Password: "x", EmailVerified: true})
+		state := start(jwt.MapClaims{"sub": "subject-2", "email": "bob@example.com", "email_verified": false})
+		_, err := s.Callback(ctx, "mock", state, state, "good-code")
+		if !errors.Is(err, ErrUnverifiedEmail) {
+			t.Fatalf("got %v, want ErrUnverifiedEmail", err)
+		}
+	})
+
+	t.Run("squatted unverified account is taken over", func(t *testing.T) {
+		squatter := models.User{Email: "cat@example.com", Name: "Squatter", Password: "squatter-hash"}
+		db.Create(&squatter)
+		state := start(jwt.MapClaims{"sub": "subject-3", "email": "cat@example.com", "email_verified": true})
+		user, err := s.Callback(ctx, "mock", state, state, "good-code")
+		if err != nil {
+			t.Fatalf("Callback: %v", err)
+		}
+		if user.ID != squatter.ID {
+			t.Fatalf("linked to user %d, want %d", user.ID, squatter.ID)
+		}
+		var stored models.User
+		db.First(&stored, squatter.ID)
+		if stored.Password == "squatter-hash" || stored.TokenVersion != squatter.TokenVersion+1 || !stored.EmailVerified {
+			t.Fatalf("squatter kept access: %+v", stored)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package seo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// descriptionLength fits the snippet search engines show.
+const descriptionLength = 160
+
+var ErrBlogNotFound = errors.New("blog not found")
+
+// BlogMetadata is everything a server rendered page needs in its head.
+// OpenGraph and Twitter are keyed by the meta property names so they can
+// be written out as they are.
+type BlogMetadata struct {
+	Title        string            `json:"title"`
+	Description  string            `json:"description"`
+	CanonicalURL string            `json:"canonical_url"`
+	OpenGraph    map[string]string `json:"open_graph"`
+	Twitter      map[string]string `json:"twitter"`
+	JSONLD       articleLD         `json:"json_ld"`
+}
+
+type articleLD struct {
+	Context          string      `json:"@context"`
+	Type             string      `json:"@type"`
+	Headline         string      `json:"headline"`
+	Description      string      `json:"description"`
+	URL              string      `json:"url"`
+	MainEntityOfPage string      `json:"mainEntityOfPage"`
+	ArticleSection   string      `json:"articleSection,omitempty"`
+	DatePublished    string      `json:"datePublished"`
+	DateModified     string      `json:"dateModified"`
+	Author           personLD    `json:"author"`
+	Publisher        publisherLD `json:"publisher"`
+}
+
+type personLD struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type publisherLD struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// BlogMetadata describes a public blog. Blogs a signed out visitor can't
+// read are reported as not found so nothing about them leaks into
+// previews.
+func (s *Service) BlogMetadata(blogId uint) (*BlogMetadata, error) {
+	var b models.Blog
+	err := s.db.Preload("Author").Scopes(blog.VisibleTo(0)).First(&b, blogId).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBlogNotFound
+		}
+		return nil, err
+	}
+
+	canonical := utils.BlogURL(s.appURL, b.ID)
+	authorURL := utils.AuthorURL(s.appURL, b.AuthorID)
+	description := utils.Excerpt(b.Content, descriptionLength)
+	published := b.CreatedAt.UTC().Format(time.RFC3339)
+	modified := b.UpdatedAt.UTC().Format(time.RFC3339)
+
+	return &BlogMetadata{
+		Title:        b.Title,
+		Description:  description,
+		CanonicalURL: canonical,
+		OpenGraph: map[string]string{
+			"og:type":                "article",
+			"og:title":               b.Title,
+			"og:description":         description,
+			"og:url":                 canonical,
+			"og:site_name":           siteName,
+			"article:published_time": published,
+			"article:modified_time":  modified,
+			"article:author":         authorURL,
+			"article:section":        b.Genre,
+		},
+		Twitter: map[string]string{
+			"twitter:card":        "summary",
+			"twitter:title":       b.Title,
+			"twitter:description": description,
+		},
+		JSONLD: articleLD{
+			Context:          "https://schema.org",
+			Type:             "Article",
+			Headline:         b.Title,
+			Description:      description,
+			URL:              canonical,
+			MainEntityOfPage: canonical,
+			ArticleSection:   b.Genre,
+			DatePublished:    published,
+			DateModified:     modified,
+			Author:           personLD{Type: "Person", Name: b.Author.Name, URL: authorURL},
+			Publisher:        publisherLD{Type: "Organization", Name: siteName, URL: s.appURL},
+		},
+	}, nil
+}
@@ -0,0 +1,21 @@
+package seo
+
+import (
+	"gorm.io/gorm"
+)
+
+const siteName = "BoldNarratives"
+
+// Service describes public content to search engines and link previews.
+// Like feeds it only covers what a signed out visitor can see.
+type Service struct {
+	db     *gorm.DB
+	appURL string
+	apiURL string
+	// pageSize is how many URLs go in one sitemap
+	pageSize int
+}
+
+func NewService(db *gorm.DB, appURL, apiURL string) *Service {
+	return &Service{db: db, appURL: appURL, apiURL: apiURL, pageSize: maxSitemapURLs}
+}
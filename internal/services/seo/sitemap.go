@@ -0,0 +1,178 @@
+package seo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// maxSitemapURLs is the most URLs the sitemap protocol allows in one file.
+const maxSitemapURLs = 50000
+
+const (
+	SectionBlogs   = "blogs"
+	SectionAuthors = "authors"
+	SectionGenres  = "genres"
+)
+
+var ErrSitemapNotFound = errors.New("sitemap not found")
+
+// sections lists the sitemaps in the order the index shows them.
+var sections = []string{SectionBlogs, SectionAuthors, SectionGenres}
+
+// entry is one URL in a sitemap before it is turned into a link. Position
+// numbers entries from 1 so they can be split into pages.
+type entry struct {
+	Key      string
+	LastMod  time.Time
+	Position int
+}
+
+type pageStat struct {
+	Page    int
+	LastMod time.Time
+}
+
+// entries selects every entry of a section.
+func (s *Service) entries(section string) *gorm.DB {
+	switch section {
+	case SectionBlogs:
+		return s.db.Model(&models.Blog{}).
+			Scopes(blog.VisibleTo(0)).
+			Select("blogs.id::text AS key, blogs.updated_at AS last_mod, ROW_NUMBER() OVER (ORDER BY blogs.id) AS position")
+	case SectionAuthors:
+		// only people who have published something visible have a profile
+		// worth indexing; anonymized and placeholder accounts never do
+		published := s.db.Model(&models.Blog{}).
+			Scopes(blog.VisibleTo(0)).
+			Select("1").
+			Where("blogs.author_id = users.id")
+		return s.db.Model(&models.User{}).
+			Select("users.id::text AS key, users.updated_at AS last_mod, ROW_NUMBER() OVER (ORDER BY users.id) AS position").
+			Where("NOT users.is_private AND users.email NOT LIKE ?", "%@"+user.ReservedEmailDomain).
+			Where("EXISTS (?)", published)
+	case SectionGenres:
+		return s.db.Model(&models.Blog{}).
+			Scopes(blog.VisibleTo(0)).
+			Select("blogs.genre AS key, MAX(blogs.updated_at) AS last_mod, ROW_NUMBER() OVER (ORDER BY blogs.genre) AS position").
+			Group("blogs.genre")
+	}
+	return nil
+}
+
+func (s *Service) loc(section, key string) string {
+	switch section {
+	case SectionBlogs:
+		id, _ := strconv.ParseUint(key, 10, 32)
+		return utils.BlogURL(s.appURL, uint(id))
+	case SectionAuthors:
+		id, _ := strconv.ParseUint(key, 10, 32)
+		return utils.AuthorURL(s.appURL, uint(id))
+	default:
+		return utils.GenreURL(s.appURL, key)
+	}
+}
+
+// SitemapName is the file name of one page of a section.
+func SitemapName(section string, page int) string {
+	return fmt.Sprintf("%s-%d.xml", section, page)
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+type sitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// SitemapIndex lists one sitemap per page of each section, with the
+// newest change on that page as its lastmod.
+func (s *Service) SitemapIndex() ([]byte, error) {
+	index := sitemapIndex{}
+	for _, section := range sections {
+		var pages []pageStat
+		err := s.db.Table("(?) AS entries", s.entries(section)).
+			Select("(entries.position - 1) / ? + 1 AS page, MAX(entries.last_mod) AS last_mod", s.pageSize).
+			Group("page").
+			Order("page").
+			Scan(&pages).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			index.Sitemaps = append(index.Sitemaps, sitemapRef{
+				Loc:     fmt.Sprintf("%s/api/sitemaps/%s", s.apiURL, SitemapName(section, page.Page)),
+				LastMod: lastMod(page.LastMod),
+			})
+		}
+	}
+	return marshalXML(index)
+}
+
+// Sitemap is one page of up to maxSitemapURLs URLs from a section.
+func (s *Service) Sitemap(section string, page int) ([]byte, error) {
+	if page < 1 {
+		return nil, ErrSitemapNotFound
+	}
+	query := s.entries(section)
+	if query == nil {
+		return nil, ErrSitemapNotFound
+	}
+	var entries []entry
+	err := s.db.Table("(?) AS entries", query).
+		Where("entries.position > ? AND entries.position <= ?", (page-1)*s.pageSize, page*s.pageSize).
+		Order("entries.position").
+		Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	// the first page of a section always exists, even when it is empty
+	if len(entries) == 0 && page > 1 {
+		return nil, ErrSitemapNotFound
+	}
+
+	set := urlSet{URLs: make([]sitemapURL, 0, len(entries))}
+	for _, e := range entries {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     s.loc(section, e.Key),
+			LastMod: lastMod(e.LastMod),
+		})
+	}
+	return marshalXML(set)
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,115 @@
+package seo
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/user"
+)
+
+func TestSitemapName(t *testing.T) {
+	if got := SitemapName(SectionBlogs, 3); got != "blogs-3.xml" {
+		t.Errorf("SitemapName = %q", got)
+	}
+}
+
+// TestSitemapPagination splits each section into pages of two URLs.
+func TestSitemapPagination(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.Blog{}, &models.Comment{}, &models.Vote{}, &models.Follows{})
+	s := NewService(db, "https://app.test", "https://api.test")
+	s.pageSize = 2
+
+	newUser := func(email string, private bool) *models.User {
+		u := &models.User{Email: email, Name: email, Password: "x"}
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+		if private {
+			db.Model(u).Update("is_private", true)
+		}
+		return u
+	}
+	newBlog := func(author *models.User, genre string) *models.Blog {
+		b := &models.Blog{Title: "t", Content: "c", Genre: genre, AuthorID: author.ID}
+		if err := db.Create(b).Error; err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	ann := newUser("ann@example.com", false)
+	for _, genre := range []string{"Technology", "Technology", "Science", "Science"} {
+		newBlog(ann, genre)
+	}
+	// a private author, an author whose only blog is deleted, someone who
+	// never wrote and the deleted-user placeholder are not indexed as authors
+	newBlog(newUser("bob@example.com", true), "Politics")
+	db.Delete(newBlog(newUser("cat@example.com", false), "Travel"))
+	newUser("dan@example.com", false)
+	last := newBlog(newUser("deleted-user@"+user.ReservedEmailDomain, false), "Poetry")
+
+	body, err := s.SitemapIndex()
+	if err != nil {
+		t.Fatalf("SitemapIndex: %v", err)
+	}
+	var index sitemapIndex
+	if err := xml.Unmarshal(body, &index); err != nil {
+		t.Fatal(err)
+	}
+	// five public blogs, one author, three genres
+	want := []string{"blogs-1.xml", "blogs-2.xml", "blogs-3.xml", "authors-1.xml", "genres-1.xml", "genres-2.xml"}
+	if len(index.Sitemaps) != len(want) {
+		t.Fatalf("index lists %d sitemaps, want %d: %+v", len(index.Sitemaps), len(want), index.Sitemaps)
+	}
+	for i, name := range want {
+		if loc := "https://api.test/api/sitemaps/" + name; index.Sitemaps[i].Loc != loc {
+			t.Errorf("sitemap %d = %q, want %q", i, index.Sitemaps[i].Loc, loc)
+		}
+	}
+
+	tests := []struct {
+		section string
+		page    int
+		want    []string
+		wantErr error
+	}{
+		{section: SectionBlogs, page: 3, want: []string{fmt.Sprintf("https://app.test/blog/%d", last.ID)}},
+		{section: SectionBlogs, page: 4, wantErr: ErrSitemapNotFound},
+		{section: SectionAuthors, page: 1, want: []string{fmt.Sprintf("https://app.test/profile/%d", ann.ID)}},
+		{section: SectionAuthors, page: 2, wantErr: ErrSitemapNotFound},
+		{section: SectionGenres, page: 1, want: []string{"https://app.test/genre/Poetry", "https://app.test/genre/Science"}},
+		{section: SectionGenres, page: 2, want: []string{"https://app.test/genre/Technology"}},
+		{section: SectionGenres, page: 0, wantErr: ErrSitemapNotFound},
+		{section: "users", page: 1, wantErr: ErrSitemapNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(SitemapName(tt.section, tt.page), func(t *testing.T) {
+			body, err := s.Sitemap(tt.section, tt.page)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sitemap: %v", err)
+			}
+			var set urlSet
+			if err := xml.Unmarshal(body, &set); err != nil {
+				t.Fatal(err)
+			}
+			if len(set.URLs) != len(tt.want) {
+				t.Fatalf("got %+v, want %v", set.URLs, tt.want)
+			}
+			for i, loc := range tt.want {
+				if set.URLs[i].Loc != loc {
+					t.Errorf("URL %d = %q, want %q", i, set.URLs[i].Loc, loc)
+				}
+			}
+		})
+	}
+}
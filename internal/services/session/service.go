@@ -0,0 +1,129 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// last-seen is only written when the stored value is older than this, so
+// active clients cost one read per request rather than a write
+const lastSeenResolution = 5 * time.Minute
+
+const maxUserAgentLength = 512
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrInvalidSession  = errors.New("session has been signed out or has expired")
+)
+
+type Service struct {
+	db   *gorm.DB
+	keys *utils.KeySet
+}
+
+func NewService(db *gorm.DB, keys *utils.KeySet) *Service {
+	return &Service{db: db, keys: keys}
+}
+
+// IssueToken records a new session for user and returns the JWT for it.
+func (s *Service) IssueToken(user *models.User, userAgent, ip string) (string, error) {
+	id, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+	session := &models.Session{
+		ID:         id,
+		UserID:     user.ID,
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(utils.TokenTTL),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return "", err
+	}
+	return utils.GenerateToken(user.Email, user.ID, user.TokenVersion, session.ID, s.keys)
+}
+
+// Touch checks that the session is still live and refreshes its last-seen
+// time when that is stale.
+func (s *Service) Touch(sessionId string, userId uint) error {
+	var session models.Session
+	err := s.db.Select("id", "user_id", "expires_at", "revoked_at", "last_seen_at").
+		Where("id=?", sessionId).First(&session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidSession
+		}
+		return err
+	}
+	now := time.Now()
+	if session.UserID != userId || session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return ErrInvalidSession
+	}
+
+	if now.Sub(session.LastSeenAt) > lastSeenResolution {
+		// the condition keeps concurrent requests from all writing
+		s.db.Model(&models.Session{}).
+			Where("id=? AND last_seen_at < ?", sessionId, now.Add(-lastSeenResolution)).
+			Update("last_seen_at", now)
+	}
+	return nil
+}
+
+func (s *Service) ListSessions(userId uint, currentId string) ([]models.SessionResponse, error) {
+	var sessions []models.Session
+	err := s.db.Where("user_id=? AND revoked_at IS NULL AND expires_at > ?", userId, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, models.SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentId,
+		})
+	}
+	return response, nil
+}
+
+func (s *Service) RevokeSession(userId uint, sessionId string) error {
+	result := s.db.Model(&models.Session{}).
+		Where("id=? AND user_id=? AND revoked_at IS NULL", sessionId, userId).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeOtherSessions signs the user out everywhere except keepId, which may
+// be empty to sign out everywhere.
+func (s *Service) RevokeOtherSessions(userId uint, keepId string) error {
+	return RevokeAll(s.db.Where("id <> ?", keepId), userId)
+}
+
+// RevokeAll marks every live session of the user as revoked. It takes the
+// db handle so callers can run it inside their own transaction.
+func RevokeAll(db *gorm.DB, userId uint) error {
+	return db.Model(&models.Session{}).
+		Where("user_id=? AND revoked_at IS NULL", userId).
+		Update("revoked_at", time.Now()).Error
+}
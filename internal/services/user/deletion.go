@@ -0,0 +1,288 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/blog"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeletionGracePeriod is how long a user can change their mind before their
+// account is anonymized.
+const DeletionGracePeriod = 30 * 24 * time.Hour
+
+// ReservedEmailDomain is used for anonymized and placeholder accounts and
+// can't be signed up with.
+const ReservedEmailDomain = "boldnarratives.invalid"
+
+const (
+	BlogsDelete   = "delete"
+	BlogsReassign = "reassign"
+
+	// placeholder account that reassigned content is attributed to
+	deletedUserEmail = "deleted-user@" + ReservedEmailDomain
+	deletedUserName  = "Deleted user"
+
+	AuditDeletionScheduled = "account.deletion_scheduled"
+	AuditDeletionCancelled = "account.deletion_cancelled"
+	AuditAccountAnonymized = "account.anonymized"
+)
+
+var (
+	ErrDeletionScheduled    = errors.New("account deletion is already scheduled")
+	ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+)
+
+func (s *Service) ScheduleDeletion(userId uint, password, blogAction, ip string) (*models.User, error) {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletionScheduledAt != nil {
+		return nil, ErrDeletionScheduled
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+
+	due := time.Now().Add(DeletionGracePeriod)
+	err = s.db.Model(user).Updates(map[string]interface{}{
+		"deletion_scheduled_at": due,
+		"deletion_blog_action":  blogAction,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	user.DeletionScheduledAt = &due
+	s.recordAudit(&user.ID, AuditDeletionScheduled, ip, fmt.Sprintf("due %s, blogs: %s", due.Format(time.RFC3339), blogAction))
+	return user, nil
+}
+
+func (s *Service) CancelDeletion(userId uint, ip string) error {
+	result := s.db.Model(&models.User{}).
+		Where("id=? AND deletion_scheduled_at IS NOT NULL", userId).
+		Updates(map[string]interface{}{
+			"deletion_scheduled_at": nil,
+			"deletion_blog_action":  "",
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeletionNotScheduled
+	}
+	s.recordAudit(&userId, AuditDeletionCancelled, ip, "")
+	return nil
+}
+
+// purgeDueAccounts anonymizes every account whose grace period is over.
+func (s *Service) purgeDueAccounts() {
+	var ids []uint
+	err := s.db.Model(&models.User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Printf("failed to list accounts due for deletion: %v", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.anonymizeUser(id); err != nil {
+			log.Printf("failed to anonymize user %d: %v", id, err)
+			continue
+		}
+		s.recordAudit(&id, AuditAccountAnonymized, "", "")
+	}
+}
+
+// anonymizeUser strips personal data from the account and detaches or
+// removes everything it owned, in one transaction.
+func (s *Service) anonymizeUser(userId uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		// lock the row so two replicas don't purge it at once
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id=? AND deletion_scheduled_at IS NOT NULL", userId).
+			First(&user).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+
+		placeholder, err := deletedUserPlaceholder(tx)
+		if err != nil {
+			return err
+		}
+
+		if user.DeletionBlogAction == BlogsReassign {
+			if err := tx.Model(&models.Blog{}).Where("author_id=?", userId).Update("author_id", placeholder.ID).Error; err != nil {
+				return err
+			}
+		} else {
+			if err := eraseBlogs(tx, userId, false); err != nil {
+				return err
+			}
+		}
+		// blogs and comments the user already deleted are only soft deleted
+		if err := eraseBlogs(tx, userId, true); err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("author_id=? AND deleted_at IS NOT NULL", userId).Delete(&models.Comment{}).Error; err != nil {
+			return err
+		}
+
+		// comments stay so threads keep making sense, but lose their author
+		if err := tx.Model(&models.Comment{}).Where("author_id=?", userId).Update("author_id", placeholder.ID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("follower_id=? OR following_id=?", userId, userId).Delete(&models.Follows{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("requester_id=? OR target_id=?", userId, userId).Delete(&models.FollowRequest{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("notification_id IN (SELECT id FROM notifications WHERE user_id = ?) OR actor_id = ?", userId, userId).Delete(&models.NotificationActor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id=? OR actor_id=?", userId, userId).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id=? OR dismissed_id=?", userId, userId).Delete(&models.SuggestionDismissal{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("blocker_id=? OR blocked_id=?", userId, userId).Delete(&models.Block{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("muter_id=? OR muted_id=?", userId, userId).Delete(&models.Mute{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)", userId).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id=?", userId).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		// jobs for the account or its exports go too; a running one finds
+		// them gone
+		err = tx.Where("status <> ?", models.JobRunning).
+			Where("payload::jsonb ->> 'user_id' = ? OR payload::jsonb ->> 'export_id' IN (SELECT id::text FROM data_exports WHERE user_id = ?)",
+				strconv.FormatUint(uint64(userId), 10), userId).
+			Delete(&models.Job{}).Error
+		if err != nil {
+			return err
+		}
+		// the audit trail keeps what happened to the account but not where
+		// from or the details, which can name the address
+		err = tx.Model(&models.AuditLog{}).Where("user_id=?", userId).Updates(map[string]interface{}{
+			"ip":     "",
+			"detail": "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		// their votes go, so the blogs they voted on need recounting
+		var votedOn []uint
+		if err := tx.Model(&models.Vote{}).Where("user_id=?", userId).Pluck("blog_id", &votedOn).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{
+			&models.Vote{},
+			&models.Session{},
+			&models.PersonalAccessToken{},
+			&models.UserIdentity{},
+			&models.RecoveryCode{},
+			&models.PasswordResetToken{},
+			&models.DataExport{},
+			&models.NotificationPreference{},
+		} {
+			if err := tx.Unscoped().Where("user_id=?", userId).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := blog.RecountVotes(tx, votedOn...); err != nil {
+			return err
+		}
+
+		err = tx.Model(&user).Updates(map[string]interface{}{
+			"email":                 fmt.Sprintf("deleted-%d@%s", userId, ReservedEmailDomain),
+			"name":                  deletedUserName,
+			"handle":                nil,
+			"is_private":            false,
+			"is_admin":              false,
+			"digest_frequency":      models.DigestOff,
+			"password":              "",
+			"email_verified":        false,
+			"email_verified_at":     nil,
+			"token_version":         gorm.Expr("token_version + 1"),
+			"totp_secret":           "",
+			"totp_enabled":          false,
+			"deletion_scheduled_at": nil,
+			"deletion_blog_action":  "",
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&user).Error
+	})
+}
+
+// eraseBlogs removes the user's blogs for good, with the comments, votes,
+// tags and notifications on them. With onlyDeleted it only touches blogs the user had
+// already soft deleted.
+func eraseBlogs(tx *gorm.DB, userId uint, onlyDeleted bool) error {
+	blogIds := tx.Unscoped().Model(&models.Blog{}).Select("id").Where("author_id=?", userId)
+	if onlyDeleted {
+		blogIds = blogIds.Where("deleted_at IS NOT NULL")
+	}
+	if err := tx.Unscoped().Where("blog_id IN (?)", blogIds).Delete(&models.Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("blog_id IN (?)", blogIds).Delete(&models.Vote{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("notification_id IN (SELECT id FROM notifications WHERE blog_id IN (?))", blogIds).Delete(&models.NotificationActor{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("blog_id IN (?)", blogIds).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("blog_id IN (?)", blogIds).Delete(&models.LiveReader{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("blog_id IN (?)", blogIds).Delete(&models.BlogTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN (?)", blogIds).Delete(&models.Blog{}).Error
+}
+
+// deletedUserPlaceholder finds or creates the account that reassigned blogs
+// and comments are shown under. It can't be signed in to.
+func deletedUserPlaceholder(tx *gorm.DB) (*models.User, error) {
+	var placeholder models.User
+	err := tx.Where("email=?", deletedUserEmail).First(&placeholder).Error
+	if err == nil {
+		return &placeholder, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	placeholder = models.User{
+		Email: deletedUserEmail,
+		Name:  deletedUserName,
+		// no password hash matches an empty string
+		Password: "",
+	}
+	if err := tx.Create(&placeholder).Error; err != nil {
+		return nil, err
+	}
+	return &placeholder, nil
+}
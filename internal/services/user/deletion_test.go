@@ -0,0 +1,83 @@
+package user
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+// TestAnonymizeErasesJobsAndAudit checks that no job or audit entry left
+// behind by an erased account still points at it or names its address.
+func TestAnonymizeErasesJobsAndAudit(t *testing.T) {
+	db := dbtest.Open(t,
+		&models.User{}, &models.Blog{}, &models.BlogTag{}, &models.Comment{}, &models.Vote{}, &models.Follows{},
+		&models.FollowRequest{}, &models.Notification{}, &models.NotificationActor{},
+		&models.SuggestionDismissal{}, &models.Block{}, &models.Mute{}, &models.Webhook{},
+		&models.WebhookDelivery{}, &models.Session{}, &models.PersonalAccessToken{},
+		&models.UserIdentity{}, &models.RecoveryCode{}, &models.PasswordResetToken{},
+		&models.DataExport{}, &models.NotificationPreference{}, &models.LiveReader{},
+		&models.Job{}, &models.AuditLog{}, &models.LoginThrottle{},
+	)
+	s := &Service{db: db}
+	due := time.Now().Add(-time.Minute)
+	ann := &models.User{Email: "ann@example.com", Name: "Ann", Password: "x", DeletionScheduledAt: &due, DeletionBlogAction: BlogsDelete}
+	bob := &models.User{Email: "bob@example.com", Name: "Bob", Password: "x"}
+	for _, u := range []*models.User{ann, bob} {
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	export := &models.DataExport{UserID: ann.ID, Status: models.ExportPending}
+	if err := db.Create(export).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []struct {
+		kind    string
+		payload interface{}
+	}{
+		{KindSendVerification, verificationJob{UserID: ann.ID}},
+		{KindBuildExport, exportJob{ExportID: export.ID}},
+		{KindSendVerification, verificationJob{UserID: bob.ID}},
+	} {
+		if _, err := jobs.Enqueue(db, job.kind, job.payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// six wrong passwords lock the account and write an audit entry
+	for i := 0; i <= accountThrottle.freeAttempts; i++ {
+		s.recordFailedLogin(&ann.ID, ann.Email, "192.0.2.1")
+	}
+	var lockouts []models.AuditLog
+	if err := db.Where("action=?", AuditLoginLockout).Find(&lockouts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(lockouts) != 1 || strings.Contains(lockouts[0].Detail, ann.Email) {
+		t.Fatalf("lockout entries = %+v", lockouts)
+	}
+
+	if err := s.anonymizeUser(ann.ID); err != nil {
+		t.Fatalf("anonymizeUser: %v", err)
+	}
+
+	var left []models.Job
+	if err := db.Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].Payload != fmt.Sprintf(`{"user_id":%d}`, bob.ID) {
+		t.Fatalf("jobs left = %+v, want only bob's", left)
+	}
+	var audit []models.AuditLog
+	if err := db.Where("user_id=?", ann.ID).Find(&audit).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range audit {
+		if entry.IP != "" || entry.Detail != "" {
+			t.Errorf("audit entry kept %+v", entry)
+		}
+	}
+}
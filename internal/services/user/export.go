@@ -0,0 +1,292 @@
+package user
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+)
+
+// finished archives can be downloaded for this long
+const exportRetention = 7 * 24 * time.Hour
+
+var (
+	ErrExportNotFound = errors.New("export not found")
+	ErrExportNotReady = errors.New("export is not ready yet")
+	ErrExportPending  = errors.New("an export is already being prepared")
+)
+
+// ExportDocument is everything we hold about a user, one field per archive
+// entry.
+type ExportDocument struct {
+	Profile    exportProfile         `json:"profile"`
+	Blogs      []models.Blog         `json:"blogs"`
+	Comments   []models.Comment      `json:"comments"`
+	Votes      []models.Vote         `json:"votes"`
+	Following  []models.Follows      `json:"following"`
+	Followers  []models.Follows      `json:"followers"`
+	Identities []models.UserIdentity `json:"identities"`
+	Sessions   []models.Session      `json:"sessions"`
+	Blocks     []models.Block        `json:"blocks"`
+	Mutes      []models.Mute         `json:"mutes"`
+	Webhooks   []models.Webhook      `json:"webhooks"`
+	// NotificationPreferences is empty for users on the defaults
+	NotificationPreferences []models.NotificationPreference `json:"notification_preferences"`
+	ExportedAt              time.Time                       `json:"exported_at"`
+}
+
+type exportProfile struct {
+	ID               uint       `json:"id"`
+	Email            string     `json:"email"`
+	Name             string     `json:"name"`
+	Handle           *string    `json:"handle,omitempty"`
+	EmailVerified    bool       `json:"email_verified"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	IsPrivate        bool       `json:"is_private"`
+	DigestFrequency  string     `json:"digest_frequency"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletionDue      *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+// RequestExport queues a new export, which the export.build job builds.
+func (s *Service) RequestExport(userId uint, format string) (*models.DataExport, error) {
+	var pending int64
+	err := s.db.Model(&models.DataExport{}).
+		Where("user_id=? AND status IN ?", userId, []string{models.ExportPending, models.ExportProcessing}).
+		Count(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, ErrExportPending
+	}
+
+	export := &models.DataExport{
+		UserID: userId,
+		Format: format,
+		Status: models.ExportPending,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(export).Error; err != nil {
+			return err
+		}
+		_, err := enqueueExport(tx, export.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.queue.Wake()
+	return export, nil
+}
+
+func enqueueExport(db *gorm.DB, exportId uint) (bool, error) {
+	return jobs.Enqueue(db, KindBuildExport, exportJob{ExportID: exportId},
+		jobs.MaxAttempts(3), jobs.Unique(fmt.Sprintf("export:%d", exportId)))
+}
+
+// QueueOrphanedExports queues a build for unfinished exports that have no
+// job, such as those requested before exports were built by the job queue.
+// A job that finishes always settles its export, so it is safe at every
+// start.
+func (s *Service) QueueOrphanedExports() error {
+	var ids []uint
+	err := s.db.Model(&models.DataExport{}).
+		Where("status IN ?", []string{models.ExportPending, models.ExportProcessing}).
+		Where("NOT EXISTS (SELECT 1 FROM jobs WHERE jobs.kind = ? AND jobs.status IN ? AND (jobs.payload::jsonb ->> 'export_id')::bigint = data_exports.id)",
+			KindBuildExport, []string{models.JobQueued, models.JobRunning}).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+	queued := 0
+	for _, id := range ids {
+		added, err := enqueueExport(s.db, id)
+		if err != nil {
+			return err
+		}
+		if added {
+			queued++
+		}
+	}
+	if queued > 0 {
+		log.Printf("Queued %d data exports that had no build job", queued)
+		s.queue.Wake()
+	}
+	return nil
+}
+
+func (s *Service) GetExport(userId, exportId uint) (*models.DataExport, error) {
+	var export models.DataExport
+	err := s.db.Omit("archive").Where("id=? AND user_id=?", exportId, userId).First(&export).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	return &export, nil
+}
+
+func (s *Service) DownloadExport(userId, exportId uint) (*models.DataExport, error) {
+	var export models.DataExport
+	err := s.db.Where("id=? AND user_id=?", exportId, userId).First(&export).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExportNotFound
+		}
+		return nil, err
+	}
+	if export.Status != models.ExportReady {
+		return nil, ErrExportNotReady
+	}
+	return &export, nil
+}
+
+// processExport builds one export. The job is retried on failure; the
+// export is only marked failed once the last attempt fails.
+func (s *Service) processExport(ctx context.Context, exportId uint) error {
+	result := s.db.Model(&models.DataExport{}).
+		Where("id=? AND status IN ?", exportId, []string{models.ExportPending, models.ExportProcessing}).
+		Update("status", models.ExportProcessing)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	err := s.buildExport(exportId)
+	if err != nil && jobs.FinalAttempt(ctx) {
+		log.Printf("export %d failed: %v", exportId, err)
+		s.db.Model(&models.DataExport{}).Where("id=?", exportId).Updates(map[string]interface{}{
+			"status": models.ExportFailed,
+			"error":  "The export could not be built, please request a new one",
+		})
+	}
+	return err
+}
+
+func (s *Service) buildExport(exportId uint) error {
+	var export models.DataExport
+	if err := s.db.Omit("archive").First(&export, exportId).Error; err != nil {
+		return err
+	}
+	doc, err := s.collectUserData(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	var archive []byte
+	if export.Format == "zip" {
+		archive, err = zipExport(doc)
+	} else {
+		archive, err = json.MarshalIndent(doc, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(exportRetention)
+	return s.db.Model(&models.DataExport{}).Where("id=?", exportId).Updates(map[string]interface{}{
+		"status":       models.ExportReady,
+		"archive":      archive,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+func (s *Service) collectUserData(userId uint) (*ExportDocument, error) {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	doc := &ExportDocument{
+		Profile: exportProfile{
+			ID:               user.ID,
+			Email:            user.Email,
+			Name:             user.Name,
+			Handle:           user.Handle,
+			EmailVerified:    user.EmailVerified,
+			TwoFactorEnabled: user.TOTPEnabled,
+			IsPrivate:        user.IsPrivate,
+			DigestFrequency:  user.DigestFrequency,
+			CreatedAt:        user.CreatedAt,
+			UpdatedAt:        user.UpdatedAt,
+			DeletionDue:      user.DeletionScheduledAt,
+		},
+		ExportedAt: time.Now(),
+	}
+
+	queries := []struct {
+		dest  interface{}
+		query *gorm.DB
+	}{
+		{&doc.Blogs, s.db.Preload("Tags").Where("author_id=?", userId).Order("created_at")},
+		{&doc.Comments, s.db.Where("author_id=?", userId).Order("created_at")},
+		{&doc.Votes, s.db.Where("user_id=?", userId).Order("created_at")},
+		{&doc.Following, s.db.Where("follower_id=?", userId).Order("created_at")},
+		{&doc.Followers, s.db.Where("following_id=?", userId).Order("created_at")},
+		{&doc.Identities, s.db.Where("user_id=?", userId)},
+		{&doc.Sessions, s.db.Where("user_id=?", userId).Order("created_at")},
+		{&doc.Blocks, s.db.Where("blocker_id=?", userId).Order("created_at")},
+		{&doc.Mutes, s.db.Where("muter_id=?", userId).Order("created_at")},
+		{&doc.Webhooks, s.db.Where("user_id=?", userId).Order("created_at")},
+		{&doc.NotificationPreferences, s.db.Where("user_id=?", userId)},
+	}
+	for _, q := range queries {
+		if err := q.query.Find(q.dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func zipExport(doc *ExportDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", doc.Profile},
+		{"blogs.json", doc.Blogs},
+		{"comments.json", doc.Comments},
+		{"votes.json", doc.Votes},
+		{"following.json", doc.Following},
+		{"followers.json", doc.Followers},
+		{"identities.json", doc.Identities},
+		{"sessions.json", doc.Sessions},
+		{"blocks.json", doc.Blocks},
+		{"mutes.json", doc.Mutes},
+		{"webhooks.json", doc.Webhooks},
+		{"notification_preferences.json", doc.NotificationPreferences},
+	}
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *Service) deleteExpiredExports() {
+	if err := s.db.Where("expires_at < ?", time.Now()).Delete(&models.DataExport{}).Error; err != nil {
+		log.Printf("failed to delete expired exports: %v", err)
+	}
+}
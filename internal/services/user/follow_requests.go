@@ -0,0 +1,125 @@
+package user
+
+import (
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrFollowRequestNotFound = errors.New("follow request not found")
+	ErrAlreadyRequested      = errors.New("you have already asked to follow this user")
+)
+
+// createFollow also revives a follow that was soft deleted before unfollows
+// became hard deletes. approved marks follows that came from an approved
+// request. tx should be a transaction so the follow and its event are
+// saved together.
+func createFollow(tx *gorm.DB, followerId, followingId uint, approved bool) error {
+	err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "follower_id"}, {Name: "following_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"deleted_at": nil}),
+	}).Create(&models.Follows{FollowerID: followerId, FollowingID: followingId}).Error
+	if err != nil {
+		return err
+	}
+	return events.Emit(tx, events.UserFollowed{FollowerID: followerId, FollowingID: followingId, Approved: approved})
+}
+
+func requestFollow(tx *gorm.DB, requesterId, targetId uint) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.FollowRequest{RequesterID: requesterId, TargetID: targetId})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAlreadyRequested
+	}
+	return events.Emit(tx, events.FollowRequested{RequesterID: requesterId, TargetID: targetId})
+}
+
+// SetPrivate changes who can see the user's posts. Going public approves
+// every pending request, since anyone may follow a public account.
+func (s *Service) SetPrivate(userId uint, private bool) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id=?", userId).Update("is_private", private).Error; err != nil {
+			return err
+		}
+		if err := events.Emit(tx, events.AccessChanged{AuthorID: userId}); err != nil {
+			return err
+		}
+		if private {
+			return nil
+		}
+		var requests []models.FollowRequest
+		if err := tx.Where("target_id=?", userId).Find(&requests).Error; err != nil {
+			return err
+		}
+		for _, r := range requests {
+			if err := createFollow(tx, r.RequesterID, userId, true); err != nil {
+				return err
+			}
+		}
+		return tx.Where("target_id=?", userId).Delete(&models.FollowRequest{}).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+func (s *Service) ListFollowRequests(userId uint) ([]models.FollowRequestResponse, error) {
+	var requests []models.FollowRequest
+	err := s.db.Where("target_id=?", userId).Preload("Requester").Order("created_at DESC").Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	response := make([]models.FollowRequestResponse, 0, len(requests))
+	for _, r := range requests {
+		response = append(response, models.FollowRequestResponse{
+			ID:        r.ID,
+			UserID:    r.RequesterID,
+			Name:      r.Requester.Name,
+			CreatedAt: r.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+func (s *Service) ApproveFollowRequest(userId, requestId uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var request models.FollowRequest
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id=? AND target_id=?", requestId, userId).First(&request).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrFollowRequestNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := createFollow(tx, request.RequesterID, userId, true); err != nil {
+			return err
+		}
+		return tx.Delete(&request).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.dispatcher.Wake()
+	return nil
+}
+
+func (s *Service) DenyFollowRequest(userId, requestId uint) error {
+	result := s.db.Where("id=? AND target_id=?", requestId, userId).Delete(&models.FollowRequest{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrFollowRequestNotFound
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package user
+
+import (
+	"errors"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"gorm.io/gorm"
+)
+
+// ErrPrivateAccount is returned when someone who doesn't follow a private
+// account asks for its followers or following.
+var ErrPrivateAccount = errors.New("this account is private")
+
+// relationColumns adds the viewer's relationship to each listed user.
+const relationColumns = `users.id, users.name, COALESCE(users.handle, '') AS handle, follows.created_at AS followed_at,
+	EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = users.id AND f.following_id = @viewer AND f.deleted_at IS NULL) AS follows_you,
+	EXISTS (SELECT 1 FROM follows f WHERE f.follower_id = @viewer AND f.following_id = users.id AND f.deleted_at IS NULL) AS is_following`
+
+type Page struct {
+	Skip  int
+	Limit int
+}
+
+func (s *Service) CheckIfFollowing(followerId, followingId uint) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.Follows{}).Where("follower_id=? AND following_id=?", followerId, followingId).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetFollowers lists who follows userId, newest first, as seen by viewerId.
+func (s *Service) GetFollowers(userId, viewerId uint, page Page) ([]models.FollowResponse, int64, error) {
+	return s.listFollows(userId, viewerId, "follows.following_id", "follows.follower_id", page)
+}
+
+// GetFollowing lists who userId follows, newest first, as seen by viewerId.
+func (s *Service) GetFollowing(userId, viewerId uint, page Page) ([]models.FollowResponse, int64, error) {
+	return s.listFollows(userId, viewerId, "follows.follower_id", "follows.following_id", page)
+}
+
+// GetMutualFollowers lists the people viewerId follows who also follow
+// userId.
+func (s *Service) GetMutualFollowers(userId, viewerId uint, page Page) ([]models.FollowResponse, int64, error) {
+	if err := s.checkCanSeeFollows(userId, viewerId); err != nil {
+		return nil, 0, err
+	}
+	query := func() *gorm.DB {
+		return s.db.Model(&models.Follows{}).
+			Joins("JOIN users ON users.id = follows.follower_id AND users.deleted_at IS NULL").
+			Where("follows.following_id=?", userId).
+			Where("follows.follower_id IN (SELECT following_id FROM follows WHERE follower_id = ? AND deleted_at IS NULL)", viewerId)
+	}
+	return s.scanFollows(query, viewerId, page)
+}
+
+func (s *Service) GetFollowSummary(userId, viewerId uint) (*models.FollowSummary, error) {
+	var target models.User
+	err := s.db.Select("id").First(&target, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.FollowSummary{UserID: userId}
+	if err := s.db.Model(&models.Follows{}).Where("following_id=?", userId).Count(&summary.Followers).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(&models.Follows{}).Where("follower_id=?", userId).Count(&summary.Following).Error; err != nil {
+		return nil, err
+	}
+	if viewerId == userId {
+		return summary, nil
+	}
+
+	err = s.db.Model(&models.Follows{}).
+		Where("following_id=?", userId).
+		Where("follower_id IN (SELECT following_id FROM follows WHERE follower_id = ? AND deleted_at IS NULL)", viewerId).
+		Count(&summary.Mutuals).Error
+	if err != nil {
+		return nil, err
+	}
+	if summary.IsFollowing, err = s.CheckIfFollowing(viewerId, userId); err != nil {
+		return nil, err
+	}
+	if summary.FollowsYou, err = s.CheckIfFollowing(userId, viewerId); err != nil {
+		return nil, err
+	}
+	var requests int64
+	err = s.db.Model(&models.FollowRequest{}).Where("requester_id=? AND target_id=?", viewerId, userId).Count(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+	summary.Requested = requests > 0
+	return summary, nil
+}
+
+// listFollows lists the users in listColumn of the follows rows whose
+// ownerColumn is userId.
+func (s *Service) listFollows(userId, viewerId uint, ownerColumn, listColumn string, page Page) ([]models.FollowResponse, int64, error) {
+	if err := s.checkCanSeeFollows(userId, viewerId); err != nil {
+		return nil, 0, err
+	}
+	query := func() *gorm.DB {
+		return s.db.Model(&models.Follows{}).
+			Joins("JOIN users ON users.id = "+listColumn+" AND users.deleted_at IS NULL").
+			Where(ownerColumn+"=?", userId)
+	}
+	return s.scanFollows(query, viewerId, page)
+}
+
+func (s *Service) scanFollows(query func() *gorm.DB, viewerId uint, page Page) ([]models.FollowResponse, int64, error) {
+	var total int64
+	if err := query().Scopes(block.NotBlocked(viewerId, "users.id")).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	follows := make([]models.FollowResponse, 0)
+	err := query().
+		Select(relationColumns, map[string]interface{}{"viewer": viewerId}).
+		Scopes(block.NotBlocked(viewerId, "users.id")).
+		Order("follows.created_at DESC, users.id").
+		Offset(page.Skip).
+		Limit(page.Limit).
+		Scan(&follows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return follows, total, nil
+}
+
+// checkCanSeeFollows hides the lists of private accounts from everyone but
+// their followers, and hides users who blocked the viewer entirely.
+func (s *Service) checkCanSeeFollows(userId, viewerId uint) error {
+	var target models.User
+	err := s.db.Select("id", "is_private").First(&target, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if userId == viewerId {
+		return nil
+	}
+	blocked, err := block.Between(s.db, userId, viewerId)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrUserNotFound
+	}
+	if !target.IsPrivate {
+		return nil
+	}
+	following, err := s.CheckIfFollowing(viewerId, userId)
+	if err != nil {
+		return err
+	}
+	if !following {
+		return ErrPrivateAccount
+	}
+	return nil
+}
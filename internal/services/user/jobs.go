@@ -0,0 +1,51 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+)
+
+const (
+	KindBuildExport        = "export.build"
+	KindAccountMaintenance = "account.maintenance"
+	KindPasswordReset      = "user.password_reset"
+	KindSendVerification   = "user.send_verification"
+)
+
+type exportJob struct {
+	ExportID uint `json:"export_id"`
+}
+
+// passwordResetJob carries the account a reset link goes to, or only the
+// address hash when nobody is registered with it.
+type passwordResetJob struct {
+	UserID    uint   `json:"user_id,omitempty"`
+	EmailHash string `json:"email_hash,omitempty"`
+}
+
+type verificationJob struct {
+	UserID uint `json:"user_id"`
+}
+
+// RegisterJobs installs the account jobs: sending reset and verification
+// mail, building data exports, and once a minute deleting expired exports
+// and purging accounts whose deletion grace period is over.
+func (s *Service) RegisterJobs(q *jobs.Queue) {
+	jobs.Handle(q, KindBuildExport, func(ctx context.Context, p exportJob) error {
+		return s.processExport(ctx, p.ExportID)
+	})
+	jobs.Handle(q, KindPasswordReset, func(ctx context.Context, p passwordResetJob) error {
+		return s.sendPasswordReset(ctx, p.UserID)
+	})
+	jobs.Handle(q, KindSendVerification, func(ctx context.Context, p verificationJob) error {
+		return s.sendQueuedVerification(ctx, p.UserID)
+	})
+	jobs.Handle(q, KindAccountMaintenance, func(ctx context.Context, _ struct{}) error {
+		s.deleteExpiredExports()
+		s.purgeDueAccounts()
+		return nil
+	})
+	q.Every(KindAccountMaintenance, time.Minute)
+}
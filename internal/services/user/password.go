@@ -0,0 +1,174 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/session"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const resetTokenTTL = time.Hour
+
+var (
+	ErrInvalidResetToken = errors.New("reset link is invalid or has expired")
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+)
+
+// RequestPasswordReset queues a reset link for email. A job is queued
+// whether or not the address is registered, so the request takes the same
+// time and gives the same answer either way. Repeated requests for an
+// address or from a client are refused with a LockedError.
+func (s *Service) RequestPasswordReset(email, ip string) error {
+	if err := s.throttleMail(email, ip); err != nil {
+		return err
+	}
+	emailHash := utils.HashToken(normalizeEmail(email))
+
+	// the queue only holds the account id, or a hash of an unknown address
+	job := passwordResetJob{EmailHash: emailHash}
+	var user models.User
+	err := s.db.Select("id").Where("email=?", email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil {
+		job = passwordResetJob{UserID: user.ID}
+	}
+	// a burst of requests for one address sends a single link
+	return s.queue.Enqueue(KindPasswordReset, job, jobs.Unique("password_reset:"+emailHash))
+}
+
+// sendPasswordReset mails a reset link to the account a reset was
+// requested for. Jobs for unknown addresses have no account and do nothing.
+func (s *Service) sendPasswordReset(ctx context.Context, userId uint) error {
+	if userId == 0 {
+		return nil
+	}
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// only the newest link works
+		if err := tx.Where("user_id=? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: utils.HashToken(token),
+			ExpiresAt: time.Now().Add(resetTokenTTL),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.appURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your BoldNarratives password",
+		Text: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. Choose a new one here:\n\n%s\n\nThe link expires in one hour and can only be used once. If this wasn't you, you can ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// ResetPassword consumes a reset token and signs the user out of every
+// existing session.
+func (s *Service) ResetPassword(token, newPassword string) error {
+	hashedPassword, err := utils.HashPasswod(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var reset models.PasswordResetToken
+		if err := tx.Where("token_hash=?", utils.HashToken(token)).First(&reset).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+
+		// guard against two requests racing on the same token
+		now := time.Now()
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id=? AND used_at IS NULL", reset.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		// following the mailed link also proves the address is theirs
+		err := tx.Model(&models.User{}).Where("id=?", reset.UserID).Updates(map[string]interface{}{
+			"password":          hashedPassword,
+			"token_version":     gorm.Expr("token_version + 1"),
+			"email_verified":    true,
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", now),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return session.RevokeAll(tx, reset.UserID)
+	})
+}
+
+// ChangePassword replaces the password of a signed-in user and returns the
+// user with the token version that new tokens must carry.
+func (s *Service) ChangePassword(userId uint, currentPassword, newPassword string) (*models.User, error) {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPasswordHash(currentPassword, user.Password) {
+		return nil, ErrIncorrectPassword
+	}
+
+	hashedPassword, err := utils.HashPasswod(newPassword)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return session.RevokeAll(tx, userId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUserById(userId)
+}
+
+func (s *Service) GetTokenVersion(userId uint) (int, error) {
+	var user models.User
+	if err := s.db.Select("token_version").First(&user, userId).Error; err != nil {
+		return 0, err
+	}
+	return user.TokenVersion, nil
+}
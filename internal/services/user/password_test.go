@@ -0,0 +1,52 @@
+package user
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+)
+
+// TestRequestPasswordResetPayload checks that reset jobs never store the
+// address they were requested for.
+func TestRequestPasswordResetPayload(t *testing.T) {
+	db := dbtest.Open(t, &models.User{}, &models.LoginThrottle{}, &models.Job{})
+	s := &Service{db: db, queue: jobs.NewQueue(db, 1)}
+	u := &models.User{Email: "ann@example.com", Name: "Ann", Password: "x"}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email string
+		want  passwordResetJob
+	}{
+		{email: "ann@example.com", want: passwordResetJob{UserID: u.ID}},
+		{email: "Nobody@Example.com", want: passwordResetJob{EmailHash: utils.HashToken("nobody@example.com")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if err := s.RequestPasswordReset(tt.email, "192.0.2.1"); err != nil {
+				t.Fatalf("RequestPasswordReset: %v", err)
+			}
+			var job models.Job
+			if err := db.Where("kind=?", KindPasswordReset).Order("id DESC").First(&job).Error; err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(strings.ToLower(job.Payload), strings.ToLower(tt.email)) {
+				t.Fatalf("payload %s holds the address", job.Payload)
+			}
+			var got passwordResetJob
+			if err := json.Unmarshal([]byte(job.Payload), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("payload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package user
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"gorm.io/gorm"
+)
+
+var ErrHandleTaken = errors.New("this handle is already taken")
+
+// SetHandle claims a handle for the user. Handles are stored lowercase so
+// that mentions match regardless of case.
+func (s *Service) SetHandle(userId uint, handle string) (*models.User, error) {
+	handle = strings.ToLower(handle)
+	var count int64
+	err := s.db.Model(&models.User{}).Where("handle=? AND id<>?", handle, userId).Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrHandleTaken
+	}
+	if err := s.db.Model(&models.User{}).Where("id=?", userId).Update("handle", handle).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrHandleTaken
+		}
+		return nil, err
+	}
+	return s.GetUserById(userId)
+}
+
+// SearchUsers matches the query against names and handles using trigram
+// similarity, so typos still find people. Matches are ranked by follower
+// count and then by how close the match is.
+func (s *Service) SearchUsers(viewerId uint, query string, skip, limit int) ([]models.UserSummary, error) {
+	query = strings.TrimPrefix(strings.TrimSpace(query), "@")
+	pattern := "%" + escapeLike(query) + "%"
+
+	var results []models.UserSummary
+	err := s.db.Model(&models.User{}).
+		Select(`users.id, users.name, COALESCE(users.handle, '') AS handle, users.is_private,
+			(SELECT COUNT(*) FROM follows WHERE follows.following_id = users.id AND follows.deleted_at IS NULL) AS followers,
+			GREATEST(similarity(users.name, @q), similarity(COALESCE(users.handle, ''), @q)) AS score`,
+			map[string]interface{}{"q": query}).
+		Where("(users.name % @q OR users.handle % @q OR users.name ILIKE @pattern OR users.handle ILIKE @pattern)",
+			map[string]interface{}{"q": query, "pattern": pattern}).
+		Where("users.email NOT LIKE ?", "%@"+ReservedEmailDomain).
+		Scopes(block.NotBlocked(viewerId, "users.id")).
+		Order("followers DESC, score DESC, users.id").
+		Offset(skip).
+		Limit(limit).
+		Scan(&results).Error
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// escapeLike stops user input from being read as LIKE wildcards.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
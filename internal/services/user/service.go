@@ -2,21 +2,48 @@ package user
 
 import (
 	"errors"
+	"log"
+	"strings"
 
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
 	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
 	"gorm.io/gorm"
 )
 
 type Service struct {
-	db *gorm.DB
+	db         *gorm.DB
+	mailer     mailer.Mailer
+	keys       *utils.KeySet
+	dispatcher *events.Dispatcher
+	queue      *jobs.Queue
+	appURL     string
 }
 
-func NewService(db *gorm.DB) *Service {
-	return &Service{db: db}
+func NewService(db *gorm.DB, mailer mailer.Mailer, keys *utils.KeySet, dispatcher *events.Dispatcher, queue *jobs.Queue, appURL string) *Service {
+	return &Service{
+		db:         db,
+		mailer:     mailer,
+		keys:       keys,
+		dispatcher: dispatcher,
+		queue:      queue,
+		appURL:     appURL,
+	}
 }
 
+var (
+	ErrReservedEmail = errors.New("this email address can't be used")
+	ErrFollowBlocked = errors.New("you can't follow this user")
+	ErrUserNotFound  = errors.New("user not found")
+)
+
 func (s *Service) CreateUser(email, name, password string) (*models.User, error) {
+	if strings.HasSuffix(normalizeEmail(email), "@"+ReservedEmailDomain) {
+		return nil, ErrReservedEmail
+	}
 	var existingUser models.User
 	if err := s.db.Where("email=?", email).First(&existingUser).Error; err == nil {
 		return nil, errors.New("user already exists")
@@ -33,22 +60,65 @@ func (s *Service) CreateUser(email, name, password string) (*models.User, error)
 		Password: hashedPassword,
 	}
 
-	if err := s.db.Create(user).Error; err != nil {
+	// the verification link is mailed from a job queued with the account
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		_, err := jobs.Enqueue(tx, KindSendVerification, verificationJob{UserID: user.ID}, verificationUnique(user.ID))
+		return err
+	})
+	if err != nil {
+		// lost a race with another signup for the same email
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, errors.New("user already exists")
+		}
 		return nil, err
 	}
+	s.queue.Wake()
 
 	return user, nil
 }
 
-func (s *Service) AuthenticateUser(email, password string) (*models.User, error) {
+// dummyPasswordHash is checked when the email is unknown so that a miss
+// takes as long as a wrong password.
+var dummyPasswordHash, _ = utils.HashPasswod("timing-equalizer-not-a-real-password")
+
+// AuthenticateUser checks a sign-in attempt. Unknown emails and wrong
+// passwords fail identically with ErrInvalidCredentials; repeated failures
+// per email and per IP lock further attempts out with a *LockedError.
+func (s *Service) AuthenticateUser(email, password, ip string) (*models.User, error) {
+	emailKey := accountThrottle.prefix + normalizeEmail(email)
+	if err := s.checkLocked(emailKey, ipThrottle.prefix+ip); err != nil {
+		return nil, err
+	}
+
 	var user models.User
-	if err := s.db.Where("email=?", email).First(&user).Error; err == nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, errors.New("Record Not Found")
+	err := s.db.Where("email=?", email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	found := err == nil
+
+	hash := dummyPasswordHash
+	if found {
+		hash = user.Password
+	}
+	if !utils.CheckPasswordHash(password, hash) || !found {
+		var userId *uint
+		if found {
+			userId = &user.ID
 		}
+		s.recordFailedLogin(userId, email, ip)
+		return nil, ErrInvalidCredentials
 	}
-	if !utils.CheckPasswordHash(password, user.Password) {
-		return nil, errors.New("Invalid Password")
+
+	// with two-factor on, the password is only half a sign-in; the account
+	// counter also guards the code step and is cleared once that succeeds
+	if !user.TOTPEnabled {
+		if err := s.clearFailures(emailKey); err != nil {
+			log.Printf("failed to clear sign-in failures for user %d: %v", user.ID, err)
+		}
 	}
 	return &user, nil
 }
@@ -69,77 +139,74 @@ func (s *Service) GetUserProfile(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-func (s *Service) FollowUser(followerId, followingId uint) error {
+// FollowUser follows followingId, or files a follow request when that
+// account is private. requested reports which of the two happened.
+func (s *Service) FollowUser(followerId, followingId uint) (requested bool, err error) {
 	if followerId == followingId {
-		return errors.New("You cannot follow yourself")
+		return false, errors.New("You cannot follow yourself")
 	}
 	var existingFollow models.Follows
-	err := s.db.Where("follower_id=? AND following_id=?", followerId, followingId).First(&existingFollow).Error
+	err = s.db.Where("follower_id=? AND following_id=?", followerId, followingId).First(&existingFollow).Error
 	if err == nil {
-		return errors.New("You are already following this user")
+		return false, errors.New("You are already following this user")
 	}
-	follow := &models.Follows{
-		FollowerID:  followerId,
-		FollowingID: followingId,
+	blocked, err := block.Between(s.db, followerId, followingId)
+	if err != nil {
+		return false, err
 	}
-	if err := s.db.Create(follow).Error; err != nil {
-		return err
+	if blocked {
+		return false, ErrFollowBlocked
 	}
-	return nil
-}
 
-func (s *Service) UnFollowUser(followerId, followingId uint) error {
-	if followerId == followingId {
-		return errors.New("You cannot unfollow yourself")
+	var target models.User
+	err = s.db.Select("id", "is_private").First(&target, followingId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, ErrUserNotFound
 	}
-	err := s.db.Where("follower_id=? AND following_id=?", followerId, followingId).Delete(&models.Follows{}).Error
 	if err != nil {
-		return err
+		return false, err
 	}
-	return nil
-
-}
-
-func (s *Service) CheckIfFollowing(followerId, followingId uint) (bool, error) {
-	var count int64
-	err := s.db.Where("follower_id=? AND following_id=?", followerId, followingId).Count(&count).Error
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if target.IsPrivate {
+			return requestFollow(tx, followerId, followingId)
+		}
+		return createFollow(tx, followerId, followingId, false)
+	})
 	if err != nil {
 		return false, err
 	}
-	return count > 0, nil
-
+	s.dispatcher.Wake()
+	return target.IsPrivate, nil
 }
 
-func (s *Service) GetFollowers(userId uint) ([]models.FollowResponse, error) {
-	var follows []models.Follows
-
-	err := s.db.Where("following_id=?", userId).Preload("Follower").Find(&follows).Error
-	if err != nil {
-		return nil, err
+func (s *Service) UnFollowUser(followerId, followingId uint) error {
+	if followerId == followingId {
+		return errors.New("You cannot unfollow yourself")
 	}
-	var followers []models.FollowResponse
-	for _, follow := range follows {
-		followers = append(followers, models.FollowResponse{
-			ID:   follow.Follower.ID,
-			Name: follow.Follower.Name,
-		})
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// hard delete so that following again doesn't collide with the old row
+		err := tx.Unscoped().Where("follower_id=? AND following_id=?", followerId, followingId).Delete(&models.Follows{}).Error
+		if err != nil {
+			return err
+		}
+		// unfollowing also withdraws a pending request
+		if err := tx.Where("requester_id=? AND target_id=?", followerId, followingId).Delete(&models.FollowRequest{}).Error; err != nil {
+			return err
+		}
+		// the follower may have lost sight of a private account's posts
+		return events.Emit(tx, events.AccessChanged{UserIDs: []uint{followerId}})
+	})
+	if err != nil {
+		return err
 	}
-	return followers, nil
+	s.dispatcher.Wake()
+	return nil
 }
 
-func (s *Service) GetFollowing(userId uint) ([]models.FollowResponse, error) {
-	var follows []models.Follows
-	err := s.db.Where("follower_id=?", userId).Preload("Following").Find(&follows).Error
-	if err != nil {
-		return nil, err
-	}
-	var following []models.FollowResponse
-	for _, follow := range follows {
-		following = append(following, models.FollowResponse{
-			ID:   follow.Following.ID,
-			Name: follow.Following.Name,
-		})
+func (s *Service) IsAdmin(userId uint) (bool, error) {
+	var user models.User
+	if err := s.db.Select("is_admin").First(&user, userId).Error; err != nil {
+		return false, err
 	}
-	return following, nil
-
+	return user.IsAdmin, nil
 }
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/services/block"
+	"gorm.io/gorm/clause"
+)
+
+// suggestionsQuery scores every account the user could follow. Each person
+// the user follows who already follows the candidate is worth three points,
+// each genre the user votes in that the candidate writes in is worth two,
+// and popularity adds a log-scaled bonus so big accounts don't drown out
+// everything else.
+const suggestionsQuery = `
+WITH fof AS (
+	SELECT f2.following_id AS user_id, COUNT(DISTINCT f1.following_id) AS mutual
+	FROM follows f1
+	JOIN follows f2 ON f2.follower_id = f1.following_id AND f2.deleted_at IS NULL
+	WHERE f1.follower_id = @me AND f1.deleted_at IS NULL
+	GROUP BY f2.following_id
+), liked_genres AS (
+	SELECT DISTINCT blogs.genre
+	FROM votes JOIN blogs ON blogs.id = votes.blog_id
+	WHERE votes.user_id = @me AND votes.deleted_at IS NULL AND blogs.deleted_at IS NULL
+), genre_authors AS (
+	SELECT blogs.author_id AS user_id, COUNT(DISTINCT blogs.genre) AS shared_genres
+	FROM blogs JOIN liked_genres ON liked_genres.genre = blogs.genre
+	WHERE blogs.deleted_at IS NULL
+	GROUP BY blogs.author_id
+), popularity AS (
+	SELECT following_id AS user_id, COUNT(*) AS followers
+	FROM follows WHERE deleted_at IS NULL
+	GROUP BY following_id
+)
+SELECT users.id, users.name, COALESCE(users.handle, '') AS handle, users.is_private,
+	COALESCE(popularity.followers, 0) AS followers,
+	COALESCE(fof.mutual, 0) AS mutual,
+	COALESCE(genre_authors.shared_genres, 0) AS shared_genres
+FROM users
+LEFT JOIN fof ON fof.user_id = users.id
+LEFT JOIN genre_authors ON genre_authors.user_id = users.id
+LEFT JOIN popularity ON popularity.user_id = users.id
+WHERE users.deleted_at IS NULL
+	AND users.id <> @me
+	AND users.email NOT LIKE @reserved
+	AND users.id NOT IN (SELECT following_id FROM follows WHERE follower_id = @me AND deleted_at IS NULL)
+	AND users.id NOT IN (SELECT target_id FROM follow_requests WHERE requester_id = @me)
+	AND users.id NOT IN (SELECT dismissed_id FROM suggestion_dismissals WHERE user_id = @me)
+	AND users.id NOT IN (@hidden)
+	AND (fof.mutual > 0 OR genre_authors.shared_genres > 0 OR popularity.followers > 0)
+ORDER BY 3 * COALESCE(fof.mutual, 0)
+	+ 2 * COALESCE(genre_authors.shared_genres, 0)
+	+ LN(1 + COALESCE(popularity.followers, 0)) DESC, users.id
+LIMIT @limit`
+
+type suggestionRow struct {
+	models.UserSummary
+	Mutual       int64
+	SharedGenres int64
+}
+
+// SuggestFollows returns people the user might want to follow, each with a
+// short reason. People already followed, requested, blocked, muted or
+// dismissed are never suggested.
+func (s *Service) SuggestFollows(userId uint, limit int) ([]models.FollowSuggestion, error) {
+	var rows []suggestionRow
+	err := s.db.Raw(suggestionsQuery, map[string]interface{}{
+		"me":       userId,
+		"reserved": "%@" + ReservedEmailDomain,
+		"hidden":   block.Hidden(s.db, userId),
+		"limit":    limit,
+	}).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]models.FollowSuggestion, 0, len(rows))
+	for _, row := range rows {
+		suggestions = append(suggestions, models.FollowSuggestion{
+			UserSummary: row.UserSummary,
+			Reason:      suggestionReason(row),
+		})
+	}
+	return suggestions, nil
+}
+
+func suggestionReason(row suggestionRow) string {
+	switch {
+	case row.Mutual == 1:
+		return "Followed by 1 person you follow"
+	case row.Mutual > 1:
+		return fmt.Sprintf("Followed by %d people you follow", row.Mutual)
+	case row.SharedGenres > 0:
+		return "Writes in genres you enjoy"
+	}
+	return "Popular on BoldNarratives"
+}
+
+func (s *Service) DismissSuggestion(userId, dismissedId uint) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.SuggestionDismissal{UserID: userId, DismissedID: dismissedId}).Error
+}
@@ -0,0 +1,167 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type throttlePolicy struct {
+	prefix string
+	// failures allowed before the key is locked at all
+	freeAttempts int
+	baseLockout  time.Duration
+	maxLockout   time.Duration
+}
+
+var (
+	accountThrottle = throttlePolicy{prefix: "email:", freeAttempts: 5, baseLockout: 30 * time.Second, maxLockout: time.Hour}
+	ipThrottle      = throttlePolicy{prefix: "ip:", freeAttempts: 20, baseLockout: 30 * time.Second, maxLockout: time.Hour}
+
+	// requests that send mail count whether or not they succeed
+	mailAccountThrottle = throttlePolicy{prefix: "mail-email:", freeAttempts: 3, baseLockout: time.Minute, maxLockout: time.Hour}
+	mailIPThrottle      = throttlePolicy{prefix: "mail-ip:", freeAttempts: 10, baseLockout: time.Minute, maxLockout: time.Hour}
+)
+
+// failures older than this no longer count towards a lockout
+const throttleWindow = time.Hour
+
+const AuditLoginLockout = "login.lockout"
+
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// LockedError is returned while an account or client is locked out.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed sign-in attempts, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// lockoutFor returns how long a key stays locked after its n-th failure.
+func (p throttlePolicy) lockoutFor(failures int) time.Duration {
+	if failures <= p.freeAttempts {
+		return 0
+	}
+	lockout := p.baseLockout << (failures - p.freeAttempts - 1)
+	if lockout <= 0 || lockout > p.maxLockout {
+		return p.maxLockout
+	}
+	return lockout
+}
+
+// checkLocked returns a LockedError if any of the keys is locked right now.
+func (s *Service) checkLocked(keys ...string) error {
+	var throttles []models.LoginThrottle
+	if err := s.db.Where("key IN ? AND locked_until > ?", keys, time.Now()).Find(&throttles).Error; err != nil {
+		return err
+	}
+	var retryAfter time.Duration
+	for _, t := range throttles {
+		if wait := time.Until(*t.LockedUntil); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+	if retryAfter > 0 {
+		return &LockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordFailure bumps the counter for key and locks it once it has run out
+// of free attempts. It returns the failure count and the lockout this
+// failure caused, if any.
+func (s *Service) recordFailure(policy throttlePolicy, key string) (int, time.Duration, error) {
+	now := time.Now()
+	throttle := models.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}
+
+	// one statement so concurrent failures can't lose increments
+	err := s.db.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", now.Add(-throttleWindow)),
+				"last_failure_at": now,
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "failures"}}},
+	).Create(&throttle).Error
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lockout := policy.lockoutFor(throttle.Failures)
+	if lockout == 0 {
+		return throttle.Failures, 0, nil
+	}
+	lockedUntil := now.Add(lockout)
+	err = s.db.Model(&models.LoginThrottle{}).Where("key=?", key).Update("locked_until", lockedUntil).Error
+	return throttle.Failures, lockout, err
+}
+
+func (s *Service) recordFailedLogin(userId *uint, email, ip string) {
+	for _, f := range []struct {
+		policy throttlePolicy
+		value  string
+		// what the audit log calls the key; the address itself is left out
+		// so it doesn't outlive the account
+		label string
+	}{
+		{accountThrottle, normalizeEmail(email), "account"},
+		{ipThrottle, ip, "ip " + ip},
+	} {
+		failures, lockout, err := s.recordFailure(f.policy, f.policy.prefix+f.value)
+		if err != nil {
+			log.Printf("failed to record failed sign-in for %s: %v", f.policy.prefix, err)
+			continue
+		}
+		if lockout > 0 {
+			detail := fmt.Sprintf("%s locked for %s after %d failed attempts", f.label, lockout, failures)
+			s.recordAudit(userId, AuditLoginLockout, ip, detail)
+		}
+	}
+}
+
+// throttleMail counts a request that mails email on behalf of ip and
+// returns a LockedError once either has asked too often, so the endpoints
+// can't be used to flood an inbox.
+func (s *Service) throttleMail(email, ip string) error {
+	emailKey := mailAccountThrottle.prefix + normalizeEmail(email)
+	ipKey := mailIPThrottle.prefix + ip
+	if err := s.checkLocked(emailKey, ipKey); err != nil {
+		return err
+	}
+	if _, _, err := s.recordFailure(mailAccountThrottle, emailKey); err != nil {
+		return err
+	}
+	_, _, err := s.recordFailure(mailIPThrottle, ipKey)
+	return err
+}
+
+func (s *Service) clearFailures(key string) error {
+	return s.db.Where("key=?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+func (s *Service) recordAudit(userId *uint, action, ip, detail string) {
+	entry := models.AuditLog{
+		UserID: userId,
+		Action: action,
+		IP:     ip,
+		Detail: detail,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		log.Printf("failed to write audit log %s: %v", action, err)
+	}
+}
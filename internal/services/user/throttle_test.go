@@ -0,0 +1,75 @@
+package user
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+func TestLockoutFor(t *testing.T) {
+	p := throttlePolicy{freeAttempts: 5, baseLockout: 30 * time.Second, maxLockout: time.Hour}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 5, want: 0},
+		{failures: 6, want: 30 * time.Second},
+		{failures: 7, want: time.Minute},
+		{failures: 12, want: 32 * time.Minute},
+		{failures: 13, want: time.Hour},
+		// the shift overflows long before this
+		{failures: 200, want: time.Hour},
+	}
+	for _, tt := range tests {
+		if got := p.lockoutFor(tt.failures); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestRecordFailureEscalates(t *testing.T) {
+	db := dbtest.Open(t, &models.LoginThrottle{})
+	s := &Service{db: db}
+	key := accountThrottle.prefix + "ann@example.com"
+
+	for i := 1; i <= accountThrottle.freeAttempts; i++ {
+		failures, lockout, err := s.recordFailure(accountThrottle, key)
+		if err != nil {
+			t.Fatalf("recordFailure: %v", err)
+		}
+		if failures != i || lockout != 0 {
+			t.Fatalf("failure %d: got %d failures, lockout %s", i, failures, lockout)
+		}
+	}
+	if err := s.checkLocked(key); err != nil {
+		t.Fatalf("locked after only free attempts: %v", err)
+	}
+	for _, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute} {
+		if _, lockout, err := s.recordFailure(accountThrottle, key); err != nil || lockout != want {
+			t.Fatalf("lockout = %s, %v, want %s", lockout, err, want)
+		}
+	}
+	var locked *LockedError
+	if err := s.checkLocked(key, ipThrottle.prefix+"192.0.2.1"); !errors.As(err, &locked) || locked.RetryAfter > 2*time.Minute {
+		t.Fatalf("checkLocked = %v, want a lockout of up to 2m", err)
+	}
+
+	// failures outside the window start the count over
+	if err := db.Model(&models.LoginThrottle{}).Where("key=?", key).Update("last_failure_at", time.Now().Add(-2*throttleWindow)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if failures, _, err := s.recordFailure(accountThrottle, key); err != nil || failures != 1 {
+		t.Fatalf("after the window: %d failures, %v", failures, err)
+	}
+
+	if err := s.clearFailures(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.checkLocked(key); err != nil {
+		t.Errorf("still locked after clearFailures: %v", err)
+	}
+}
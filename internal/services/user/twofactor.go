@@ -0,0 +1,217 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	totpIssuer         = "BoldNarratives"
+	recoveryCodeCount  = 10
+	twoFactorChallenge = 5 * time.Minute
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotPending = errors.New("start two-factor enrollment first")
+	ErrInvalidTwoFactor    = errors.New("invalid authentication code")
+	ErrInvalidChallenge    = errors.New("sign-in challenge is invalid or has expired")
+)
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// EnrollTwoFactor generates a fresh secret for the user. It only takes effect
+// once ConfirmTwoFactor sees a valid code from it.
+func (s *Service) EnrollTwoFactor(userId uint) (*TwoFactorEnrollment, error) {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: utils.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication and returns the
+// recovery codes. They are not stored in plain text and can't be shown
+// again.
+func (s *Service) ConfirmTwoFactor(userId uint, code string) ([]string, error) {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotPending
+	}
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactor
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		rows := make([]models.RecoveryCode, 0, len(codes))
+		for _, c := range codes {
+			rows = append(rows, models.RecoveryCode{UserID: userId, CodeHash: utils.HashToken(c)})
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor needs both the password and a current code so a stolen
+// session alone can't strip the second factor.
+func (s *Service) DisableTwoFactor(userId uint, password, code string) error {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return ErrIncorrectPassword
+	}
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   false,
+			"totp_secret":    "",
+			"totp_last_step": 0,
+		}).Error
+	})
+}
+
+// CreateTwoFactorChallenge is handed out by sign-in in place of a JWT when
+// the account has two-factor authentication enabled.
+func (s *Service) CreateTwoFactorChallenge(user *models.User) (string, error) {
+	return utils.GenerateActionToken(utils.PurposeTwoFactor, user.Email, user.ID, twoFactorChallenge, s.keys)
+}
+
+// CompleteTwoFactorChallenge checks the second factor for a pending sign-in.
+// Wrong codes count towards the same lockout as wrong passwords.
+func (s *Service) CompleteTwoFactorChallenge(challenge, code, ip string) (*models.User, error) {
+	claims, err := utils.ValidateActionToken(challenge, utils.PurposeTwoFactor, s.keys)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if err := s.checkLocked(accountThrottle.prefix+normalizeEmail(claims.Email), ipThrottle.prefix+ip); err != nil {
+		return nil, err
+	}
+	user, err := s.GetUserById(claims.UserID)
+	if err != nil || !user.TOTPEnabled {
+		return nil, ErrInvalidChallenge
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactor) {
+			s.recordFailedLogin(&user.ID, user.Email, ip)
+		}
+		return nil, err
+	}
+	if err := s.clearFailures(accountThrottle.prefix + normalizeEmail(user.Email)); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s *Service) verifySecondFactor(user *models.User, code string) error {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// each code works once, even inside its validity window
+		result := s.db.Model(&models.User{}).
+			Where("id=? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactor
+		}
+		return nil
+	}
+
+	now := time.Now()
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id=? AND code_hash=? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactor
+	}
+	return nil
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns codes like "ABCDE-FGHIJ" with 50 bits of
+// entropy each, enough that a plain SHA-256 hash is safe to store.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(b)[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 10 {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -0,0 +1,117 @@
+package user
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/database/dbtest"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+)
+
+// totpCode computes the current code for secret the way an authenticator
+// app would.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// openTwoFactor returns a service and a user with two-factor enabled whose
+// password is "password".
+func openTwoFactor(t *testing.T) (*Service, *models.User) {
+	t.Helper()
+	db := dbtest.Open(t, &models.User{}, &models.LoginThrottle{}, &models.AuditLog{}, &models.RecoveryCode{})
+	keys, err := utils.NewKeySet("test", utils.NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := utils.HashPasswod("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &models.User{Email: "ann@example.com", Name: "Ann", Password: hash, TOTPSecret: secret, TOTPEnabled: true}
+	if err := db.Create(u).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &Service{db: db, keys: keys}, u
+}
+
+func TestVerifySecondFactorReplay(t *testing.T) {
+	s, u := openTwoFactor(t)
+	code := totpCode(t, u.TOTPSecret, time.Now())
+
+	if err := s.verifySecondFactor(u, code); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	// the same code is still inside its window but was spent
+	if err := s.verifySecondFactor(u, code); !errors.Is(err, ErrInvalidTwoFactor) {
+		t.Fatalf("replay = %v, want ErrInvalidTwoFactor", err)
+	}
+	// so is a code from the step before the one that was used
+	if err := s.verifySecondFactor(u, totpCode(t, u.TOTPSecret, time.Now().Add(-30*time.Second))); !errors.Is(err, ErrInvalidTwoFactor) {
+		t.Fatalf("older step = %v, want ErrInvalidTwoFactor", err)
+	}
+	// the next step's code is accepted early to allow for clock drift
+	if err := s.verifySecondFactor(u, totpCode(t, u.TOTPSecret, time.Now().Add(30*time.Second))); err != nil {
+		t.Fatalf("next step: %v", err)
+	}
+
+	// recovery codes work once each
+	if err := s.db.Create(&models.RecoveryCode{UserID: u.ID, CodeHash: utils.HashToken("ABCDE-FGHIJ")}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.verifySecondFactor(u, "abcde fghij"); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := s.verifySecondFactor(u, "ABCDE-FGHIJ"); !errors.Is(err, ErrInvalidTwoFactor) {
+		t.Fatalf("reused recovery code = %v, want ErrInvalidTwoFactor", err)
+	}
+}
+
+// TestPasswordKeepsTwoFactorLockout guesses codes up to the last free
+// attempt and checks that signing in with the password again doesn't buy
+// more guesses.
+func TestPasswordKeepsTwoFactorLockout(t *testing.T) {
+	s, u := openTwoFactor(t)
+	const ip = "192.0.2.1"
+	challenge, err := s.CreateTwoFactorChallenge(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < accountThrottle.freeAttempts; i++ {
+		if _, err := s.CompleteTwoFactorChallenge(challenge, "wrong", ip); !errors.Is(err, ErrInvalidTwoFactor) {
+			t.Fatalf("guess %d = %v, want ErrInvalidTwoFactor", i+1, err)
+		}
+	}
+	if _, err := s.AuthenticateUser(u.Email, "password", ip); err != nil {
+		t.Fatalf("AuthenticateUser: %v", err)
+	}
+	if _, err := s.CompleteTwoFactorChallenge(challenge, "wrong", ip); !errors.Is(err, ErrInvalidTwoFactor) {
+		t.Fatalf("guess after password = %v, want ErrInvalidTwoFactor", err)
+	}
+	var locked *LockedError
+	if _, err := s.CompleteTwoFactorChallenge(challenge, totpCode(t, u.TOTPSecret, time.Now()), ip); !errors.As(err, &locked) {
+		t.Fatalf("correct code while locked = %v, want *LockedError", err)
+	}
+}
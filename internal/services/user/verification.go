@@ -0,0 +1,110 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/jobs"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/mailer"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+const verificationTokenTTL = 48 * time.Hour
+
+var (
+	ErrAlreadyVerified          = errors.New("email is already verified")
+	ErrInvalidVerificationToken = errors.New("verification link is invalid or has expired")
+)
+
+func (s *Service) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateActionToken(utils.PurposeEmailVerification, user.Email, user.ID, verificationTokenTTL, s.keys)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.appURL, url.QueryEscape(token))
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your BoldNarratives email address",
+		Text: fmt.Sprintf("Hi %s,\n\nConfirm your email address to start publishing and commenting:\n\n%s\n\nThe link expires in 48 hours. If you did not sign up, ignore this email.\n",
+			user.Name, link),
+	})
+}
+
+// ResendVerificationEmail queues another verification link. Repeated
+// requests are refused with a LockedError.
+func (s *Service) ResendVerificationEmail(userId uint, ip string) error {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrAlreadyVerified
+	}
+	if err := s.throttleMail(user.Email, ip); err != nil {
+		return err
+	}
+	return s.queue.Enqueue(KindSendVerification, verificationJob{UserID: user.ID}, verificationUnique(user.ID))
+}
+
+// verificationUnique keeps one verification mail per user in the queue.
+func verificationUnique(userId uint) jobs.Option {
+	return jobs.Unique(fmt.Sprintf("verification:%d", userId))
+}
+
+// sendQueuedVerification mails the link unless the address was verified
+// while the job waited.
+func (s *Service) sendQueuedVerification(ctx context.Context, userId uint) error {
+	user, err := s.GetUserById(userId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.sendVerificationEmail(ctx, user)
+}
+
+func (s *Service) VerifyEmail(token string) (*models.User, error) {
+	claims, err := utils.ValidateActionToken(token, utils.PurposeEmailVerification, s.keys)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := s.GetUserById(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	// a link sent to an old address must not verify a new one
+	if user.Email != claims.Email {
+		return nil, ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return user, nil
+	}
+
+	now := time.Now()
+	err = s.db.Model(user).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Service) IsEmailVerified(userId uint) (bool, error) {
+	var user models.User
+	if err := s.db.Select("email_verified").First(&user, userId).Error; err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
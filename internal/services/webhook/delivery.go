@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+const (
+	deliveryInterval = 15 * time.Second
+	deliveryTimeout  = 10 * time.Second
+	deliveryBatch    = 50
+	// a claimed delivery is retried after this long if its worker died
+	claimLease = 2 * time.Minute
+
+	maxAttempts  = 10
+	firstBackoff = 30 * time.Second
+	maxBackoff   = 6 * time.Hour
+
+	// only this much of a response body is kept in the delivery log
+	maxResponseBody = 2048
+	// delivery logs are kept this long
+	deliveryRetention = 30 * 24 * time.Hour
+)
+
+var errPrivateAddress = errors.New("webhook URL resolves to a private address")
+
+// newClient returns a client that won't follow redirects or connect to
+// loopback, private or link-local addresses, so webhooks can't be pointed
+// at our own network.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: deliveryTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   deliveryTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Sign returns the X-BoldNarratives-Signature header for payload sent at
+// timestamp. Receivers recompute the HMAC-SHA256 of "<t>.<body>" with their
+// secret, compare it to v1 and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(payload)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Run sends queued deliveries and retries failed ones with exponential
+// backoff. Claiming rows with SKIP LOCKED lets several replicas run it. It
+// blocks until ctx is cancelled.
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(deliveryInterval)
+	defer ticker.Stop()
+	for {
+		s.deliverDue(ctx)
+		s.deleteOldDeliveries()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// wakeDeliveries makes Run send now instead of at its next tick.
+func (s *Service) wakeDeliveries() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Service) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := s.claimDue()
+		if err != nil {
+			log.Printf("failed to claim webhook deliveries: %v", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		for i := range deliveries {
+			s.deliver(ctx, &deliveries[i])
+		}
+	}
+}
+
+func (s *Service) claimDue() ([]models.WebhookDelivery, error) {
+	now := time.Now()
+	var deliveries []models.WebhookDelivery
+	err := s.db.Raw(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(claimLease), now, models.DeliveryPending, now, deliveryBatch).Scan(&deliveries).Error
+	return deliveries, err
+}
+
+func (s *Service) deliver(ctx context.Context, d *models.WebhookDelivery) {
+	var webhook models.Webhook
+	if err := s.db.Unscoped().First(&webhook, d.WebhookID).Error; err != nil {
+		log.Printf("failed to load webhook %d: %v", d.WebhookID, err)
+		return
+	}
+	if webhook.DeletedAt.Valid {
+		s.finish(d, map[string]interface{}{
+			"status":          models.DeliveryFailed,
+			"next_attempt_at": nil,
+			"error":           "webhook was deleted",
+		})
+		return
+	}
+
+	status, body, err := s.send(ctx, &webhook, d)
+	attempts := d.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": status,
+		"response_body":   body,
+		"error":           "",
+	}
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		updates["status"] = models.DeliverySucceeded
+		updates["next_attempt_at"] = nil
+		updates["delivered_at"] = time.Now()
+	default:
+		if err != nil {
+			updates["error"] = err.Error()
+		} else {
+			updates["error"] = fmt.Sprintf("endpoint responded with %d", status)
+		}
+		if attempts >= maxAttempts {
+			updates["status"] = models.DeliveryFailed
+			updates["next_attempt_at"] = nil
+		} else {
+			updates["next_attempt_at"] = time.Now().Add(backoff(attempts))
+		}
+	}
+	s.finish(d, updates)
+}
+
+func (s *Service) send(ctx context.Context, webhook *models.Webhook, d *models.WebhookDelivery) (int, string, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BoldNarratives-Webhooks/1.0")
+	req.Header.Set("X-BoldNarratives-Event", d.Event)
+	req.Header.Set("X-BoldNarratives-Event-ID", d.EventID)
+	req.Header.Set("X-BoldNarratives-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-BoldNarratives-Signature", Sign(webhook.Secret, time.Now().Unix(), body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	return resp.StatusCode, string(respBody), nil
+}
+
+func (s *Service) finish(d *models.WebhookDelivery, updates map[string]interface{}) {
+	if err := s.db.Model(&models.WebhookDelivery{}).Where("id=?", d.ID).Updates(updates).Error; err != nil {
+		log.Printf("failed to record webhook delivery %d: %v", d.ID, err)
+	}
+}
+
+// backoff doubles from firstBackoff up to maxBackoff, with some jitter so
+// retries from one outage don't arrive all at once.
+func backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 20 {
+		if d := firstBackoff << (attempts - 1); d < maxBackoff {
+			wait = d
+		}
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait/10)+1))
+}
+
+func (s *Service) deleteOldDeliveries() {
+	err := s.db.Where("created_at < ? AND status <> ?", time.Now().Add(-deliveryRetention), models.DeliveryPending).
+		Delete(&models.WebhookDelivery{}).Error
+	if err != nil {
+		log.Printf("failed to delete old webhook deliveries: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		payload   string
+		want      string
+	}{
+		{
+			name:      "event payload",
+			secret:    "whsec_test",
+			timestamp: 1700000000,
+			payload:   `{"event":"blog.published"}`,
+			want:      "t=1700000000,v1=3b5caeee5711401cb23be0640dabd468165792618003c58c6dc6653c5c308e2e",
+		},
+		{
+			name: "empty everything",
+			want: "t=0,v1=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.payload)); got != tt.want {
+				t.Errorf("Sign = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignDependsOnEveryInput(t *testing.T) {
+	base := Sign("secret", 1700000000, []byte("body"))
+	for name, other := range map[string]string{
+		"secret":    Sign("other-secret", 1700000000, []byte("body")),
+		"timestamp": Sign("secret", 1700000001, []byte("body")),
+		"payload":   Sign("secret", 1700000000, []byte("body!")),
+	} {
+		if signatureOf(other) == signatureOf(base) {
+			t.Errorf("changing the %s kept the signature", name)
+		}
+	}
+}
+
+func signatureOf(header string) string {
+	_, v1, _ := strings.Cut(header, ",v1=")
+	return v1
+}
+
+// TestSendSignsTheBody checks a delivery the way a receiver would.
+func TestSendSignsTheBody(t *testing.T) {
+	const secret = "whsec_receiver"
+	var got http.Header
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		body, _ := io.ReadAll(r.Body)
+		var timestamp int64
+		var signature string
+		fmt.Sscanf(strings.Replace(r.Header.Get("X-BoldNarratives-Signature"), ",v1=", " ", 1), "t=%d %s", &timestamp, &signature)
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "%d.%s", timestamp, body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		verified = hmac.Equal([]byte(signature), []byte(expected)) && time.Since(time.Unix(timestamp, 0)) < time.Minute
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// the default client refuses loopback addresses like the test server's
+	s := &Service{client: server.Client()}
+	webhook := &models.Webhook{URL: server.URL, Secret: secret}
+	delivery := &models.WebhookDelivery{ID: 42, Event: "blog.published", EventID: "evt-1", Payload: `{"blog_id":1}`}
+	status, _, err := s.send(context.Background(), webhook, delivery)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("status = %d", status)
+	}
+	if !verified {
+		t.Errorf("receiver couldn't verify signature %q", got.Get("X-BoldNarratives-Signature"))
+	}
+	if got.Get("X-BoldNarratives-Event") != "blog.published" || got.Get("X-BoldNarratives-Event-ID") != "evt-1" ||
+		got.Get("X-BoldNarratives-Delivery") != strconv.Itoa(42) {
+		t.Errorf("headers = %v", got)
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := newClient().Get(server.URL)
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("got %v, want errPrivateAddress", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		min      time.Duration
+	}{
+		{1, firstBackoff},
+		{2, 2 * firstBackoff},
+		{5, 16 * firstBackoff},
+		{10, 512 * firstBackoff},
+		{11, maxBackoff},
+		// large attempt counts must not overflow the shift
+		{64, maxBackoff},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempts), func(t *testing.T) {
+			got := backoff(tt.attempts)
+			if got < tt.min || got > tt.min+tt.min/10 {
+				t.Errorf("backoff(%d) = %s, want %s plus up to 10%% jitter", tt.attempts, got, tt.min)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+// payload is the JSON body of every delivery.
+type payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type blogData struct {
+	ID        uint      `json:"id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content,omitempty"`
+	Genre     string    `json:"genre"`
+	AuthorID  uint      `json:"author_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func toBlogData(blog *models.Blog) blogData {
+	return blogData{
+		ID:        blog.ID,
+		Title:     blog.Title,
+		Content:   blog.Content,
+		Genre:     blog.Genre,
+		AuthorID:  blog.AuthorID,
+		CreatedAt: blog.CreatedAt,
+		UpdatedAt: blog.UpdatedAt,
+	}
+}
+
+// The methods below run from the outbox subscribers in subscribe.go.
+// eventId is stable across retries, so a retry doesn't queue a delivery
+// twice.
+
+func (s *Service) BlogPublished(eventId string, blog *models.Blog) error {
+	return s.dispatch(eventId, models.WebhookBlogPublished, blog.AuthorID, map[string]interface{}{"blog": toBlogData(blog)})
+}
+
+func (s *Service) BlogUpdated(eventId string, blog *models.Blog) error {
+	return s.dispatch(eventId, models.WebhookBlogUpdated, blog.AuthorID, map[string]interface{}{"blog": toBlogData(blog)})
+}
+
+func (s *Service) BlogDeleted(eventId string, blogId, authorId uint, title string) error {
+	return s.dispatch(eventId, models.WebhookBlogDeleted, authorId, map[string]interface{}{
+		"blog": map[string]interface{}{"id": blogId, "title": title, "author_id": authorId},
+	})
+}
+
+func (s *Service) CommentCreated(eventId string, comment *models.Comment, blog *models.Blog) error {
+	return s.dispatch(eventId, models.WebhookCommentCreated, blog.AuthorID, map[string]interface{}{
+		"comment": map[string]interface{}{
+			"id":         comment.ID,
+			"blog_id":    comment.BlogID,
+			"parent_id":  comment.ParentID,
+			"author_id":  comment.AuthorID,
+			"comment":    comment.Comment,
+			"created_at": comment.CreatedAt,
+		},
+	})
+}
+
+func (s *Service) VoteToggled(eventId string, blog *models.Blog, voterId uint, voted bool, votes int64) error {
+	return s.dispatch(eventId, models.WebhookVoteToggled, blog.AuthorID, map[string]interface{}{
+		"blog_id": blog.ID,
+		"user_id": voterId,
+		"voted":   voted,
+		"votes":   votes,
+	})
+}
+
+func (s *Service) UserFollowed(eventId string, followerId, followingId uint) error {
+	return s.dispatch(eventId, models.WebhookUserFollowed, followingId, map[string]interface{}{
+		"follower_id":  followerId,
+		"following_id": followingId,
+	})
+}
+
+// dispatch queues a delivery of event to every webhook of ownerId and every
+// global webhook subscribed to it that doesn't have one yet.
+func (s *Service) dispatch(eventId, event string, ownerId uint, data interface{}) error {
+	now := time.Now()
+	body, err := json.Marshal(payload{ID: eventId, Event: event, CreatedAt: now, Data: data})
+	if err != nil {
+		return err
+	}
+
+	result := s.db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, attempts, next_attempt_at, created_at, updated_at)
+		SELECT w.id, ?, ?, ?, ?, 0, ?, ?, ?
+		FROM webhooks w
+		WHERE w.deleted_at IS NULL AND (w.global OR w.user_id = ?) AND ? = ANY(string_to_array(w.events, ' '))
+			AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.event_id = ?)`,
+		eventId, event, string(body), models.DeliveryPending, now, now, now, ownerId, event, eventId)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		s.wakeDeliveries()
+	}
+	return nil
+}
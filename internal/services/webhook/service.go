@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/utils"
+	"gorm.io/gorm"
+)
+
+// SecretPrefix marks webhook signing secrets so secret scanners can find
+// them.
+const SecretPrefix = "bnwhsec_"
+
+const maxWebhooksPerUser = 10
+
+var (
+	ErrWebhookNotFound   = errors.New("webhook not found")
+	ErrDeliveryNotFound  = errors.New("delivery not found")
+	ErrInvalidWebhookURL = errors.New("webhook URL must be an https URL")
+	ErrTooManyWebhooks   = errors.New("you can register at most 10 webhooks")
+	ErrGlobalAdminOnly   = errors.New("only admins can register global webhooks")
+)
+
+type Service struct {
+	db     *gorm.DB
+	client *http.Client
+	wake   chan struct{}
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:     db,
+		client: newClient(),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// CreateWebhook returns the stored webhook and its signing secret, which is
+// only ever available here.
+func (s *Service) CreateWebhook(userId uint, rawURL string, events []string, global bool) (*models.Webhook, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, "", ErrInvalidWebhookURL
+	}
+	if global {
+		var user models.User
+		if err := s.db.Select("is_admin").First(&user, userId).Error; err != nil {
+			return nil, "", err
+		}
+		if !user.IsAdmin {
+			return nil, "", ErrGlobalAdminOnly
+		}
+	}
+	var count int64
+	if err := s.db.Model(&models.Webhook{}).Where("user_id=?", userId).Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxWebhooksPerUser {
+		return nil, "", ErrTooManyWebhooks
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = SecretPrefix + secret
+	webhook := &models.Webhook{
+		UserID: userId,
+		URL:    u.String(),
+		Secret: secret,
+		Events: strings.Join(events, " "),
+		Global: global,
+	}
+	if err := s.db.Create(webhook).Error; err != nil {
+		return nil, "", err
+	}
+	return webhook, secret, nil
+}
+
+func (s *Service) ListWebhooks(userId uint) ([]models.WebhookResponse, error) {
+	var webhooks []models.Webhook
+	if err := s.db.Where("user_id=?", userId).Order("created_at DESC").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	response := make([]models.WebhookResponse, 0, len(webhooks))
+	for _, w := range webhooks {
+		response = append(response, w.ToResponse())
+	}
+	return response, nil
+}
+
+// DeleteWebhook stops deliveries to the webhook. Its delivery log is kept
+// until it expires.
+func (s *Service) DeleteWebhook(userId, webhookId uint) error {
+	result := s.db.Where("id=? AND user_id=?", webhookId, userId).Delete(&models.Webhook{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (s *Service) ListDeliveries(userId, webhookId uint, skip, limit int) ([]models.WebhookDelivery, int64, error) {
+	if err := s.checkOwner(userId, webhookId); err != nil {
+		return nil, 0, err
+	}
+	query := s.db.Model(&models.WebhookDelivery{}).Where("webhook_id=?", webhookId)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var deliveries []models.WebhookDelivery
+	err := query.Order("id DESC").Offset(skip).Limit(limit).Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+// Redeliver queues a fresh attempt at sending a past delivery's payload.
+func (s *Service) Redeliver(userId, webhookId, deliveryId uint) (*models.WebhookDelivery, error) {
+	if err := s.checkOwner(userId, webhookId); err != nil {
+		return nil, err
+	}
+	var original models.WebhookDelivery
+	err := s.db.Where("id=? AND webhook_id=?", deliveryId, webhookId).First(&original).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		WebhookID:     webhookId,
+		EventID:       original.EventID,
+		Event:         original.Event,
+		Payload:       original.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	if err := s.db.Create(delivery).Error; err != nil {
+		return nil, err
+	}
+	s.wakeDeliveries()
+	return delivery, nil
+}
+
+func (s *Service) checkOwner(userId, webhookId uint) error {
+	var count int64
+	err := s.db.Model(&models.Webhook{}).Where("id=? AND user_id=?", webhookId, userId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/events"
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+)
+
+// Subscribe registers the webhook service's reactions to domain events.
+// Records are loaded including soft-deleted ones so that an event is still
+// delivered if the blog or comment went away before it was handled.
+func (s *Service) Subscribe(d *events.Dispatcher) {
+	events.On(d, "webhooks.blog_published", func(ctx context.Context, e events.BlogPublished) error {
+		var blog models.Blog
+		if err := s.db.Unscoped().First(&blog, e.BlogID).Error; err != nil {
+			return err
+		}
+		return s.BlogPublished(eventID(ctx), &blog)
+	})
+	events.On(d, "webhooks.blog_updated", func(ctx context.Context, e events.BlogUpdated) error {
+		var blog models.Blog
+		if err := s.db.Unscoped().First(&blog, e.BlogID).Error; err != nil {
+			return err
+		}
+		return s.BlogUpdated(eventID(ctx), &blog)
+	})
+	events.On(d, "webhooks.blog_deleted", func(ctx context.Context, e events.BlogDeleted) error {
+		return s.BlogDeleted(eventID(ctx), e.BlogID, e.AuthorID, e.Title)
+	})
+	events.On(d, "webhooks.comment_created", func(ctx context.Context, e events.CommentCreated) error {
+		var comment models.Comment
+		if err := s.db.Unscoped().First(&comment, e.CommentID).Error; err != nil {
+			return err
+		}
+		var blog models.Blog
+		if err := s.db.Unscoped().Select("id", "author_id").First(&blog, e.BlogID).Error; err != nil {
+			return err
+		}
+		return s.CommentCreated(eventID(ctx), &comment, &blog)
+	})
+	events.On(d, "webhooks.vote_toggled", func(ctx context.Context, e events.VoteToggled) error {
+		var blog models.Blog
+		if err := s.db.Unscoped().Select("id", "author_id").First(&blog, e.BlogID).Error; err != nil {
+			return err
+		}
+		var votes int64
+		if err := s.db.Model(&models.Vote{}).Where("blog_id=?", e.BlogID).Count(&votes).Error; err != nil {
+			return err
+		}
+		return s.VoteToggled(eventID(ctx), &blog, e.VoterID, e.Voted, votes)
+	})
+	events.On(d, "webhooks.user_followed", func(ctx context.Context, e events.UserFollowed) error {
+		return s.UserFollowed(eventID(ctx), e.FollowerID, e.FollowingID)
+	})
+}
+
+// eventID names a delivery after the outbox event behind it.
+func eventID(ctx context.Context) string {
+	return fmt.Sprintf("evt_%d", events.EventID(ctx))
+}
@@ -7,37 +7,113 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// Purposes for single-use links sent to users. Tokens carrying a purpose are
+// never accepted as login tokens.
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposeTwoFactor         = "two_factor"
+	PurposeUnsubscribe       = "unsubscribe"
+)
+
+// Access and action tokens are signed with the same keys, so each kind
+// names itself in the typ header and aud claim and is only accepted where
+// both match.
+const (
+	typAccess = "at+jwt"
+	typAction = "action+jwt"
+
+	audienceAccess = "boldnarratives-api"
+	// action tokens get one audience per purpose
+	audienceActionPrefix = "boldnarratives-action:"
+)
+
 type JWTClaims struct {
-	Email  string `json:"email"`
-	UserID uint   `json:"user_id"`
+	Email        string `json:"email"`
+	UserID       uint   `json:"user_id"`
+	TokenVersion int    `json:"ver"`
+	Purpose      string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(email string, userID uint, secret string) (string, error) {
+// TokenTTL is how long a sign-in token, and the session behind it, lasts.
+const TokenTTL = time.Hour * 60
+
+// GenerateToken signs a sign-in token for the given session. The session id
+// is carried as the jti claim.
+func GenerateToken(email string, userID uint, tokenVersion int, sessionID string, keys *KeySet) (string, error) {
 	claims := JWTClaims{
-		Email:  email,
-		UserID: userID,
+		Email:        email,
+		UserID:       userID,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 60)),
+			ID:        sessionID,
+			Audience:  jwt.ClaimStrings{audienceAccess},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return keys.Sign(typAccess, claims)
 }
 
-func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
+func ValidateToken(tokenString string, keys *KeySet) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString, typAccess, audienceAccess, keys)
+	if err != nil {
+		// sign-in tokens issued before tokens named their kind are accepted
+		// until they expire, so deploying this doesn't sign everyone out
+		legacy, legacyErr := parseLegacyToken(tokenString, keys)
+		if legacyErr != nil {
+			return nil, err
 		}
-		return []byte(secret), nil
-	})
+		claims = legacy
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// GenerateActionToken signs a short-lived token that only ValidateActionToken
+// with the same purpose will accept.
+func GenerateActionToken(purpose, email string, userID uint, ttl time.Duration, keys *KeySet) (string, error) {
+	claims := JWTClaims{
+		Email:   email,
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{audienceActionPrefix + purpose},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	return keys.Sign(typAction, claims)
+}
 
+func ValidateActionToken(tokenString, purpose string, keys *KeySet) (*JWTClaims, error) {
+	claims, err := parseToken(tokenString, typAction, audienceActionPrefix+purpose, keys)
 	if err != nil {
 		return nil, err
 	}
+	if claims.Purpose != purpose {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+// parseToken verifies the signature and that the token is of kind typ and
+// meant for audience.
+func parseToken(tokenString, typ, audience string, keys *KeySet) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, keys.keyfunc,
+		jwt.WithValidMethods([]string{AlgHS256, AlgRS256, AlgEdDSA}),
+		jwt.WithAudience(audience))
+
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := token.Header["typ"].(string); got != typ {
+		return nil, errors.New("invalid token")
+	}
 
 	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
 		return claims, nil
@@ -45,3 +121,32 @@ func ValidateToken(tokenString, secret string) (*JWTClaims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// parseLegacyToken accepts a sign-in token in the old format: signed with
+// the shared secret, without kid, typ, aud or jti, and good for at most
+// TokenTTL. Nothing else ever lacked a kid, so no other kind of token
+// passes.
+func parseLegacyToken(tokenString string, keys *KeySet) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, keys.keyfunc,
+		jwt.WithValidMethods([]string{AlgHS256}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt())
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := token.Header["kid"]; ok {
+		return nil, errors.New("invalid token")
+	}
+	if typ, _ := token.Header["typ"].(string); typ != "" && typ != "JWT" {
+		return nil, errors.New("invalid token")
+	}
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid || claims.IssuedAt == nil {
+		return nil, errors.New("invalid token")
+	}
+	if len(claims.Audience) > 0 || claims.ID != "" || claims.Purpose != "" ||
+		claims.ExpiresAt.Sub(claims.IssuedAt.Time) > TokenTTL {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
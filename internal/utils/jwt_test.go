@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testKeys(t *testing.T, secret string) *KeySet {
+	t.Helper()
+	keys, err := NewKeySet("test", NewHMACKey("test", []byte(secret)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestValidateActionToken(t *testing.T) {
+	keys := testKeys(t, "secret")
+	otherKeys := testKeys(t, "another-secret")
+
+	mustAction := func(purpose string, ttl time.Duration, keys *KeySet) string {
+		token, err := GenerateActionToken(purpose, "ann@example.com", 7, ttl, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	// signs claims as they are, to forge tokens the generators never make
+	mustSign := func(typ string, claims JWTClaims) string {
+		token, err := keys.Sign(typ, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	access, err := GenerateToken("ann@example.com", 7, 0, "session-1", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := jwt.NewNumericDate(time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		wantErr bool
+	}{
+		{
+			name:    "valid",
+			token:   mustAction(PurposeEmailVerification, time.Hour, keys),
+			purpose: PurposeEmailVerification,
+		},
+		{
+			name:    "other purpose",
+			token:   mustAction(PurposeUnsubscribe, time.Hour, keys),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   mustAction(PurposeEmailVerification, -time.Minute, keys),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name:    "signed with another key",
+			token:   mustAction(PurposeEmailVerification, time.Hour, otherKeys),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name:    "access token",
+			token:   access,
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name: "right purpose and audience but access typ",
+			token: mustSign(typAccess, JWTClaims{Purpose: PurposeEmailVerification, RegisteredClaims: jwt.RegisteredClaims{
+				Audience: jwt.ClaimStrings{audienceActionPrefix + PurposeEmailVerification}, ExpiresAt: future,
+			}}),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name: "right purpose but no audience",
+			token: mustSign(typAction, JWTClaims{Purpose: PurposeEmailVerification, RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: future,
+			}}),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name: "audience of another purpose",
+			token: mustSign(typAction, JWTClaims{Purpose: PurposeEmailVerification, RegisteredClaims: jwt.RegisteredClaims{
+				Audience: jwt.ClaimStrings{audienceActionPrefix + PurposeTwoFactor}, ExpiresAt: future,
+			}}),
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+		{
+			name:    "garbage",
+			token:   "not.a.token",
+			purpose: PurposeEmailVerification,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateActionToken(tt.token, tt.purpose, keys)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateActionToken: %v", err)
+			}
+			if claims.UserID != 7 || claims.Email != "ann@example.com" || claims.Purpose != tt.purpose {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsActionTokens(t *testing.T) {
+	keys := testKeys(t, "secret")
+	access, err := GenerateToken("ann@example.com", 7, 3, "session-1", keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(access, keys)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.TokenVersion != 3 || claims.ID != "session-1" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	for _, purpose := range []string{PurposeEmailVerification, PurposeTwoFactor, PurposeUnsubscribe} {
+		action, err := GenerateActionToken(purpose, "ann@example.com", 7, time.Hour, keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ValidateToken(action, keys); err == nil {
+			t.Errorf("%s token was accepted as an access token", purpose)
+		}
+	}
+}
+
+// TestValidateTokenAcceptsLegacyTokens covers sign-in tokens in the format
+// used before key ids, typ and aud were added.
+func TestValidateTokenAcceptsLegacyTokens(t *testing.T) {
+	keys, err := LoadKeySet("secret", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// signs the way the old GenerateToken did
+	legacy := func(secret string, edit func(*JWTClaims), header map[string]interface{}) string {
+		claims := JWTClaims{
+			Email:  "ann@example.com",
+			UserID: 7,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(now.Add(TokenTTL - time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+				NotBefore: jwt.NewNumericDate(now.Add(-time.Minute)),
+			},
+		}
+		if edit != nil {
+			edit(&claims)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "old format", token: legacy("secret", nil, nil)},
+		{name: "no typ", token: legacy("secret", nil, map[string]interface{}{"typ": nil})},
+		{name: "other secret", token: legacy("another-secret", nil, nil), wantErr: true},
+		{name: "expired", token: legacy("secret", func(c *JWTClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+		}, nil), wantErr: true},
+		{name: "no expiry", token: legacy("secret", func(c *JWTClaims) { c.ExpiresAt = nil }, nil), wantErr: true},
+		{name: "no issue time", token: legacy("secret", func(c *JWTClaims) { c.IssuedAt = nil }, nil), wantErr: true},
+		{name: "longer than a sign-in lasts", token: legacy("secret", func(c *JWTClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(TokenTTL + time.Hour))
+		}, nil), wantErr: true},
+		{name: "purpose", token: legacy("secret", func(c *JWTClaims) { c.Purpose = PurposeTwoFactor }, nil), wantErr: true},
+		{name: "audience", token: legacy("secret", func(c *JWTClaims) {
+			c.Audience = jwt.ClaimStrings{audienceActionPrefix + PurposeTwoFactor}
+		}, nil), wantErr: true},
+		{name: "session id", token: legacy("secret", func(c *JWTClaims) { c.ID = "session-1" }, nil), wantErr: true},
+		{name: "action typ", token: legacy("secret", nil, map[string]interface{}{"typ": typAction}), wantErr: true},
+		{name: "kid", token: legacy("secret", nil, map[string]interface{}{"kid": legacyKeyID}), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ValidateToken(tt.token, keys)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateToken: %v", err)
+			}
+			if claims.UserID != 7 || claims.TokenVersion != 0 || claims.ID != "" {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+
+	// without the shared secret there is nothing to check them against
+	rotated, err := NewKeySet("new", NewHMACKey("new", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(legacy("secret", nil, nil), rotated); err == nil {
+		t.Error("legacy token accepted without the legacy key")
+	}
+	// and action links never fall back to the old format
+	if _, err := ValidateActionToken(legacy("secret", func(c *JWTClaims) { c.Purpose = PurposeTwoFactor }, nil), PurposeTwoFactor, keys); err == nil {
+		t.Error("legacy action token accepted")
+	}
+}
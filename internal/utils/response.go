@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"net/http"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/validation"
 	"github.com/gin-gonic/gin"
 )
 
@@ -9,6 +12,7 @@ type Response struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 type PaginatedResponse struct {
@@ -21,28 +25,38 @@ type PaginatedResponse struct {
 }
 
 func SuccessResponse(c *gin.Context, statusCode int, message string, data interface{}) {
-	c.JSON(statusCode,Response{
-		Success:true,
-		Message:message,
-		Data:data,
+	c.JSON(statusCode, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
 	})
 
 }
 
 func ErrorResponse(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode,Response{
-		Success:false,
-		Error:message,
+	c.JSON(statusCode, Response{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// ValidationErrorResponse reports a request binding error with one entry
+// per offending field.
+func ValidationErrorResponse(c *gin.Context, err error) {
+	c.JSON(http.StatusBadRequest, Response{
+		Success: false,
+		Error:   "Validation failed",
+		Details: validation.Errors(err),
 	})
 }
 
 func PaginatedSuccessResponse(c *gin.Context, statusCode int, data interface{}, total uint64, pageSizes int, page int, totalPages int) {
-	c.JSON(statusCode,PaginatedResponse{
-		Success:true,
-		Data:data,
-		Total:total,
-		PageSizes:pageSizes,
-		Page:page,
-		TotalPages:totalPages,
+	c.JSON(statusCode, PaginatedResponse{
+		Success:    true,
+		Data:       data,
+		Total:      total,
+		PageSizes:  pageSizes,
+		Page:       page,
+		TotalPages: totalPages,
 	})
 }
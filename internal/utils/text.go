@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Excerpt collapses whitespace in content and shortens it to about length
+// characters on a word boundary.
+func Excerpt(content string, length int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) <= length {
+		return content
+	}
+	cut := string([]rune(content)[:length])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+// BlogURL is where the frontend shows a blog.
+func BlogURL(appURL string, blogId uint) string {
+	return fmt.Sprintf("%s/blog/%d", appURL, blogId)
+}
+
+// AuthorURL is where the frontend shows an author's profile.
+func AuthorURL(appURL string, userId uint) string {
+	return fmt.Sprintf("%s/profile/%d", appURL, userId)
+}
+
+// GenreURL is where the frontend lists the blogs in a genre.
+func GenreURL(appURL, genre string) string {
+	return fmt.Sprintf("%s/genre/%s", appURL, url.PathEscape(genre))
+}
+
+// TagURL is where the frontend lists the blogs with a tag.
+func TagURL(appURL, tag string) string {
+	return fmt.Sprintf("%s/tag/%s", appURL, url.PathEscape(tag))
+}
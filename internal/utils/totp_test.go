@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed from the RFC 6238 test vectors.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		at       int64
+		wantStep int64
+		wantOK   bool
+	}{
+		// the RFC vectors, cut to six digits
+		{name: "vector 59", secret: rfc6238Secret, code: "287082", at: 59, wantStep: 1, wantOK: true},
+		{name: "vector 1111111109", secret: rfc6238Secret, code: "081804", at: 1111111109, wantStep: 37037036, wantOK: true},
+		{name: "vector 1234567890", secret: rfc6238Secret, code: "005924", at: 1234567890, wantStep: 41152263, wantOK: true},
+		{name: "spaces and lower case secret", secret: " " + strings.ToLower(rfc6238Secret), code: "287 082", at: 59, wantStep: 1, wantOK: true},
+		// a code is good for one step either side and reports its own step
+		{name: "one step late", secret: rfc6238Secret, code: "287082", at: 59 + 30, wantStep: 1, wantOK: true},
+		{name: "one step early", secret: rfc6238Secret, code: "287082", at: 59 - 30, wantStep: 1, wantOK: true},
+		{name: "two steps late", secret: rfc6238Secret, code: "287082", at: 59 + 60},
+		{name: "wrong code", secret: rfc6238Secret, code: "287083", at: 59},
+		{name: "too short", secret: rfc6238Secret, code: "28708", at: 59},
+		{name: "eight digits", secret: rfc6238Secret, code: "94287082", at: 59},
+		{name: "bad secret", secret: "not base32!", code: "287082", at: 59},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("ValidateTOTP = %d, %v, want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/datmedevil17/BoldNarrativesBackend/internal/models"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+const (
+	PasswordMinLength = 8
+	// bcrypt ignores everything after the 72nd byte
+	PasswordMaxLength = 72
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Register installs the custom tags used by the request types on gin's
+// validator engine. It must run before the router starts serving.
+func Register() error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected validator engine")
+	}
+
+	// report fields by their json (or query) names so they match the request
+	v.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
+		if name == "" {
+			name = strings.SplitN(fld.Tag.Get("form"), ",", 2)[0]
+		}
+		if name == "-" || name == "" {
+			return fld.Name
+		}
+		return name
+	})
+
+	if err := v.RegisterValidation("password", validatePassword); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("genre", validateGenre); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("tag", validateTag); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("notblank", validateNotBlank); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("scope", validateScope); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("handle", validateHandle); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("webhookevent", validateWebhookEvent); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validatePassword(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < PasswordMinLength || len(password) > PasswordMaxLength {
+		return false
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	return hasLetter && hasDigit
+}
+
+func validateGenre(fl validator.FieldLevel) bool {
+	return models.IsValidGenre(fl.Field().String())
+}
+
+func validateTag(fl validator.FieldLevel) bool {
+	return models.IsValidTag(models.NormalizeTag(fl.Field().String()))
+}
+
+func validateScope(fl validator.FieldLevel) bool {
+	return models.IsValidScope(fl.Field().String())
+}
+
+func validateWebhookEvent(fl validator.FieldLevel) bool {
+	return models.IsValidWebhookEvent(fl.Field().String())
+}
+
+func validateHandle(fl validator.FieldLevel) bool {
+	return handlePattern.MatchString(fl.Field().String())
+}
+
+func validateNotBlank(fl validator.FieldLevel) bool {
+	return strings.TrimSpace(fl.Field().String()) != ""
+}
+
+// Errors converts a binding error into per-field details. Errors that are
+// not tied to a field (malformed JSON, empty body) are reported with an
+// empty field name.
+func Errors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fe.Field(),
+				Message: message(fe),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("must be a %s", jsonType(typeErr.Type)),
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return []FieldError{{Message: "request body is not valid JSON"}}
+	}
+	if errors.Is(err, io.EOF) {
+		return []FieldError{{Message: "request body is required"}}
+	}
+	return []FieldError{{Message: err.Error()}}
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "password":
+		return fmt.Sprintf("must be %d-%d characters and contain at least one letter and one digit", PasswordMinLength, PasswordMaxLength)
+	case "genre", "genre|eq=All":
+		return "must be one of: " + strings.Join(models.Genres, ", ")
+	case "tag":
+		return "must be 1-30 letters, digits or single hyphens"
+	case "notblank":
+		return "must not be blank"
+	case "scope":
+		return "must be one of: " + strings.Join(models.TokenScopes, ", ")
+	case "handle":
+		return "must be 3-30 letters, digits or underscores"
+	case "webhookevent":
+		return "must be one of: " + strings.Join(models.WebhookEvents, ", ")
+	case "url":
+		return "must be a valid URL"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "unique":
+		return "must not contain duplicates"
+	case "timezone", "eq=|timezone":
+		return "must be an IANA time zone such as Europe/Berlin"
+	case "datetime", "eq=|datetime=15:04":
+		return "must be a time in the " + fe.Param() + " format"
+	}
+	return fmt.Sprintf("failed the %q check", fe.Tag())
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	}
+	return t.Kind().String()
+}